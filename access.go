@@ -0,0 +1,113 @@
+package potato
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "time"
+)
+
+const (
+    AccessLogOff      = "off"
+    AccessLogCombined = "combined"
+    AccessLogJson     = "json"
+)
+
+var (
+    //off, combined or json
+    AccessLogFormat = AccessLogOff
+    AccessLog       io.Writer
+)
+
+type accessEntry struct {
+    Time       string  `json:"time"`
+    RequestId  string  `json:"request_id"`
+    RemoteAddr string  `json:"remote_addr"`
+    Method     string  `json:"method"`
+    Uri        string  `json:"uri"`
+    Proto      string  `json:"proto"`
+    Status     int     `json:"status"`
+    Size       int64   `json:"size"`
+    Referer    string  `json:"referer"`
+    UserAgent  string  `json:"user_agent"`
+    Route      string  `json:"route"`
+    Controller string  `json:"controller"`
+    Action     string  `json:"action"`
+    Latency    float64 `json:"latency_ms"`
+}
+
+/**
+ * writeAccessLog writes one line for the finished request
+ * in apache combined format followed by potato fields, or as json
+ */
+func writeAccessLog(r *Request, p *Response, d time.Duration) {
+    if AccessLog == nil || AccessLogFormat == AccessLogOff || len(AccessLogFormat) == 0 {
+        return
+    }
+
+    route := r.Route
+    if route == nil {
+        route = &Route{}
+    }
+
+    status := p.Status
+    if status == 0 {
+        status = 200
+    }
+
+    host, _, e := net.SplitHostPort(r.RemoteAddr)
+    if e != nil {
+        host = r.RemoteAddr
+    }
+
+    buf := new(bytes.Buffer)
+    if AccessLogFormat == AccessLogJson {
+        entry := &accessEntry{
+            Time:       r.StartedAt.Format(time.RFC3339),
+            RequestId:  r.Id,
+            RemoteAddr: host,
+            Method:     r.Method,
+            Uri:        r.RequestURI,
+            Proto:      r.Proto,
+            Status:     status,
+            Size:       p.Size,
+            Referer:    r.Referer(),
+            UserAgent:  r.UserAgent(),
+            Route:      route.Name,
+            Controller: route.Controller,
+            Action:     route.Action,
+            Latency:    float64(d) / float64(time.Millisecond),
+        }
+
+        if e := json.NewEncoder(buf).Encode(entry); e != nil {
+            L.Error("could not encode access log", "error", e)
+            return
+        }
+    } else {
+        size := "-"
+        if p.Size > 0 {
+            size = fmt.Sprint(p.Size)
+        }
+
+        fmt.Fprintf(buf, "%s - - [%s] %q %d %s %q %q rid=%s route=%s action=%s.%s latency=%.3fms\n",
+            host, r.StartedAt.Format("02/Jan/2006:15:04:05 -0700"),
+            r.Method+" "+r.RequestURI+" "+r.Proto, status, size,
+            r.Referer(), r.UserAgent(), r.Id, dash(route.Name),
+            dash(route.Controller), dash(route.Action),
+            float64(d)/float64(time.Millisecond))
+    }
+
+    if _, e := AccessLog.Write(buf.Bytes()); e != nil {
+        L.Error("could not write access log", "error", e)
+    }
+}
+
+func dash(s string) string {
+    if len(s) == 0 {
+        return "-"
+    }
+
+    return s
+}
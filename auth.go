@@ -0,0 +1,219 @@
+package potato
+
+import (
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+const (
+    userKey = "_user_id"
+)
+
+var (
+    //loads users for the ids kept in sessions, must be set to use auth
+    Users UserLoader
+
+    //where unauthenticated browsers are redirected on auth routes
+    //with the requested url in the next param, empty responds 401
+    AuthLoginUrl = ""
+)
+
+type User interface {
+    UserId() string
+    UserRoles() []string
+}
+
+/**
+ * UserLoader returns nil without error if the user is not found
+ */
+type UserLoader interface {
+    LoadUser(id string) (User, error)
+}
+
+/**
+ * HasRole tells if the user has any of the roles
+ */
+func HasRole(u User, roles ...string) bool {
+    if u == nil {
+        return false
+    }
+
+    for _, have := range u.UserRoles() {
+        for _, want := range roles {
+            if have == want {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+/**
+ * Login keeps the user in session, the session id is regenerated
+ * so an id known before login is useless after it
+ */
+func (c *Controller) Login(u User) error {
+    s := c.Request.Session
+    if e := s.Regenerate(); e != nil {
+        return e
+    }
+
+    s.Set(userKey, u.UserId(), true)
+    c.Request.SetUser(u)
+    return nil
+}
+
+/**
+ * Logout forgets the user and regenerates the session id
+ */
+func (c *Controller) Logout() error {
+    s := c.Request.Session
+    c.Request.SetUser(nil)
+    if s.isPending() {
+        return nil
+    }
+
+    s.Delete(userKey)
+    return s.Regenerate()
+}
+
+func (c *Controller) CurrentUser() User {
+    return c.Request.User()
+}
+
+/**
+ * User returns the current user, loaded once per request
+ * from the session unless set by other ways of authentication
+ */
+func (r *Request) User() User {
+    if r.userLoaded {
+        return r.user
+    }
+
+    r.userLoaded = true
+    id, ok := r.Session.String(userKey)
+    if !ok || len(id) == 0 {
+        return nil
+    }
+
+    r.user = loadUser(id)
+    return r.user
+}
+
+/**
+ * SetUser sets the current user of the request
+ */
+func (r *Request) SetUser(u User) {
+    r.user = u
+    r.userLoaded = true
+}
+
+/**
+ * authenticate sets the current user from the Authorization header
+ * on prefixes with basic_auth or bearer
+ */
+func authenticate(r *Request) {
+    pr := r.Route.prefix
+    if pr == nil {
+        return
+    }
+
+    header := r.Header.Get("Authorization")
+    if pr.Bearer && len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+        id, e := VerifyToken(strings.TrimSpace(header[7:]))
+        if e != nil {
+            L.Debug("bearer token refused", "error", e)
+            return
+        }
+
+        if u := apiUser(id); u != nil {
+            r.SetUser(u)
+            r.bearerAuth = true
+        }
+        return
+    }
+
+    if pr.htpasswd != nil {
+        if name, pass, ok := r.BasicAuth(); ok && pr.htpasswd.Check(name, pass) {
+            if u := apiUser(name); u != nil {
+                r.SetUser(u)
+            }
+        }
+    }
+}
+
+/**
+ * apiUser loads the user authenticated by basic auth or token
+ * from Users, if Users is not set the user has the id only and no roles
+ * nil is returned if Users does not know the id or fails to load it,
+ * so deleted users lose access along with their tokens
+ */
+func apiUser(id string) User {
+    if Users == nil {
+        return &basicUser{id}
+    }
+
+    return loadUser(id)
+}
+
+func loadUser(id string) User {
+    if Users == nil {
+        L.Error("potato.Users is not set, could not load user")
+        return nil
+    }
+
+    u, e := Users.LoadUser(id)
+    if e != nil {
+        L.Error("could not load user", "id", id, "error", e)
+        return nil
+    }
+
+    return u
+}
+
+/**
+ * authorize runs before dispatching and csrf checking
+ * it authenticates api clients first, then on routes with auth or roles
+ * browsers go to AuthLoginUrl, others get 401 if not logged in
+ * and 403 if logged in without any of the roles
+ */
+func authorize(r *Request, p *Response) bool {
+    authenticate(r)
+    route := r.Route
+    if !route.Auth && len(route.Roles) == 0 {
+        return true
+    }
+
+    u := r.User()
+    if u == nil {
+        if pr := route.prefix; pr != nil && (pr.htpasswd != nil || pr.Bearer) {
+            if pr.htpasswd != nil {
+                realm := pr.Realm
+                if len(realm) == 0 {
+                    realm = AppName
+                }
+                p.Header().Add("WWW-Authenticate", `Basic realm="`+strings.Replace(realm, `"`, "", -1)+`"`)
+            }
+            if pr.Bearer {
+                p.Header().Add("WWW-Authenticate", "Bearer")
+            }
+            http.Error(p, "unauthorized", http.StatusUnauthorized)
+        } else if len(AuthLoginUrl) > 0 && !r.IsAjax() && r.Method == "GET" {
+            to := AuthLoginUrl + "?next=" + url.QueryEscape(r.URL.RequestURI())
+            http.Redirect(p, r.Request, to, http.StatusFound)
+        } else {
+            http.Error(p, "unauthorized", http.StatusUnauthorized)
+        }
+
+        return false
+    }
+
+    if len(route.Roles) > 0 && !HasRole(u, route.Roles...) {
+        http.Error(p, "forbidden", http.StatusForbidden)
+        return false
+    }
+
+    return true
+}
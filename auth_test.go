@@ -0,0 +1,119 @@
+package potato
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+type apiController struct {
+    Controller
+}
+
+func (c *apiController) Save() {
+    c.RenderText("saved " + c.CurrentUser().UserId())
+}
+
+func apiRouter() *Router {
+    rt := NewRouter()
+    rt.SetControllers(map[string]interface{}{"api": &apiController{}})
+    rt.routes = []*PrefixedRoutes{{
+        Prefix: "/api",
+        Bearer: true,
+        Routes: []*Route{{Name: "save", Controller: "api", Action: "Save", Pattern: "/save", Auth: true}},
+    }}
+    rt.initRoutes()
+    return rt
+}
+
+func TestBearerPostSkipsCSRF(t *testing.T) {
+    TokenKeys = []string{"secret"}
+    defer func() { TokenKeys = nil }()
+
+    token, e := IssueToken("bob", time.Minute)
+    if e != nil {
+        t.Fatal(e)
+    }
+
+    r := httptest.NewRequest("POST", "/api/save", nil)
+    r.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    apiRouter().ServeHTTP(w, r)
+    if w.Code != http.StatusOK || w.Body.String() != "saved bob" {
+        t.Fatalf("bearer post got %d %q", w.Code, w.Body.String())
+    }
+}
+
+func TestPostWithoutAuthorization(t *testing.T) {
+    TokenKeys = []string{"secret"}
+    defer func() { TokenKeys = nil }()
+
+    tests := []struct {
+        header string
+        status int
+    }{
+        {"", http.StatusUnauthorized},
+        {"Bearer bad.token.here", http.StatusUnauthorized},
+    }
+
+    for _, test := range tests {
+        r := httptest.NewRequest("POST", "/api/save", nil)
+        if len(test.header) > 0 {
+            r.Header.Set("Authorization", test.header)
+        }
+        w := httptest.NewRecorder()
+        apiRouter().ServeHTTP(w, r)
+        if w.Code != test.status {
+            t.Errorf("%q got %d, want %d", test.header, w.Code, test.status)
+        }
+    }
+}
+
+type userLoaderFunc func(id string) (User, error)
+
+func (f userLoaderFunc) LoadUser(id string) (User, error) {
+    return f(id)
+}
+
+func TestBearerUserMustBeLoaded(t *testing.T) {
+    TokenKeys = []string{"secret"}
+    defer func() { TokenKeys, Users = nil, nil }()
+
+    token, _ := IssueToken("bob", 0)
+    tests := []struct {
+        name   string
+        users  UserLoader
+        status int
+    }{
+        {"no loader", nil, http.StatusOK},
+        {"known", userLoaderFunc(func(id string) (User, error) { return &basicUser{id}, nil }), http.StatusOK},
+        {"deleted", userLoaderFunc(func(id string) (User, error) { return nil, nil }), http.StatusUnauthorized},
+        {"failed", userLoaderFunc(func(id string) (User, error) { return nil, errors.New("db down") }), http.StatusUnauthorized},
+    }
+
+    for _, test := range tests {
+        Users = test.users
+        r := httptest.NewRequest("POST", "/api/save", nil)
+        r.Header.Set("Authorization", "Bearer "+token)
+        w := httptest.NewRecorder()
+        apiRouter().ServeHTTP(w, r)
+        if w.Code != test.status {
+            t.Errorf("%s got %d, want %d", test.name, w.Code, test.status)
+        }
+    }
+}
+
+func TestBasicAuthPostNeedsCSRF(t *testing.T) {
+    rt := apiRouter()
+    rt.routes[0].htpasswd = &Htpasswd{map[string]string{"bob": "$2y$10$hash"}}
+
+    r := httptest.NewRequest("POST", "/api/save", nil)
+    r.SetBasicAuth("bob", "pass")
+    w := httptest.NewRecorder()
+    rt.ServeHTTP(w, r)
+    if w.Code != http.StatusForbidden {
+        t.Fatalf("basic auth post without csrf token got %d", w.Code)
+    }
+}
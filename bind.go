@@ -0,0 +1,371 @@
+package potato
+
+import (
+    "encoding"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/roydong/potato/validate"
+    "io"
+    "mime"
+    "net/http"
+    "net/url"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var (
+    //memory used for multipart forms before spilling files to disk
+    MaxMultipartMemory = int64(32 * 1024 * 1024)
+
+    //max json body read by Bind in bytes, like ParseForm does for urlencoded
+    MaxJsonSize = int64(10 * 1024 * 1024)
+
+    ErrBodyTooLarge = errors.New("request body too large")
+
+    //layouts tried for time values without a time_format tag
+    TimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+    timeType            = reflect.TypeOf(time.Time{})
+    durationType        = reflect.TypeOf(time.Duration(0))
+    textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+/**
+ * binding and validation share the error types
+ */
+type FieldError = validate.FieldError
+type FieldErrors = validate.FieldErrors
+
+/**
+ * ErrorMap returns the messages keyed by field of an error from Bind
+ * other errors are keyed by an empty string
+ */
+func ErrorMap(e error) map[string]string {
+    if e == nil {
+        return map[string]string{}
+    }
+
+    if fe, ok := e.(FieldErrors); ok {
+        return fe.Map()
+    }
+
+    return map[string]string{"": e.Error()}
+}
+
+/**
+ * Bind fills the struct pointed by v from the request
+ * json bodies up to MaxJsonSize are decoded by json tags, other bodies, the query and
+ * route params are read by form tags or field names, nested fields
+ * are named like address.city and slices of structs like items.0.name
+ * with indexes counting from 0 without gaps
+ * time fields use the time_format tag or TimeLayouts
+ * route params are applied last so they win
+ * then fields are checked by their validate tags
+ * a FieldErrors is returned if any field fails
+ */
+func (r *Request) Bind(v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+        return errors.New("potato: Bind needs a pointer to struct")
+    }
+
+    errs := make(FieldErrors, 0)
+    ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    values := make(url.Values)
+
+    switch {
+    case ct == "application/json" || strings.HasSuffix(ct, "+json"):
+        e := json.NewDecoder(http.MaxBytesReader(nil, r.Body, MaxJsonSize)).Decode(v)
+        var me *http.MaxBytesError
+        if errors.As(e, &me) {
+            return ErrBodyTooLarge
+        }
+
+        if e != nil && e != io.EOF {
+            errs = append(errs, jsonFieldError(e))
+        }
+
+        for k, vs := range r.URL.Query() {
+            values[k] = vs
+        }
+
+    case ct == "multipart/form-data":
+        if e := r.parseMultipart(); e != nil {
+            return e
+        }
+        values = r.Form
+
+    default:
+        if e := r.ParseForm(); e != nil {
+            return e
+        }
+        values = r.Form
+    }
+
+    for k, p := range r.params {
+        values[k] = []string{p}
+    }
+
+    bindStruct(rv.Elem(), values, "", &errs)
+
+    //only the first error of a field is shown by Map
+    //so binding errors go before validation errors
+    if e := validate.Struct(v); e != nil {
+        if ve, ok := e.(FieldErrors); ok {
+            errs = append(errs, ve...)
+        } else {
+            errs = append(errs, &FieldError{Field: "", Message: e.Error()})
+        }
+    }
+
+    if len(errs) > 0 {
+        return errs
+    }
+
+    return nil
+}
+
+func jsonFieldError(e error) *FieldError {
+    if te, ok := e.(*json.UnmarshalTypeError); ok {
+        return &FieldError{Field: te.Field, Message: "must be " + te.Type.String()}
+    }
+
+    return &FieldError{Field: "", Message: "invalid json: " + e.Error()}
+}
+
+func bindStruct(v reflect.Value, values url.Values, prefix string, errs *FieldErrors) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if len(f.PkgPath) > 0 && !f.Anonymous {
+            continue
+        }
+
+        name := f.Tag.Get("form")
+        if name == "-" {
+            continue
+        }
+
+        //embedded structs share the names of the parent
+        if f.Anonymous && len(name) == 0 && f.Type.Kind() == reflect.Struct {
+            bindStruct(v.Field(i), values, prefix, errs)
+            continue
+        }
+
+        if len(name) == 0 {
+            name = f.Name
+        }
+
+        bindField(v.Field(i), values, prefix+name, f.Tag.Get("time_format"), errs)
+    }
+}
+
+func bindField(v reflect.Value, values url.Values, key, layout string, errs *FieldErrors) {
+    if !v.CanSet() || !hasInput(values, key) {
+        return
+    }
+
+    t := v.Type()
+    switch {
+    case t.Kind() == reflect.Ptr:
+        if v.IsNil() {
+            v.Set(reflect.New(t.Elem()))
+        }
+        bindField(v.Elem(), values, key, layout, errs)
+
+    case t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType):
+        bindStruct(v, values, key+".", errs)
+
+    case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Struct && t.Elem() != timeType:
+        //with gaps errors would be named by positions not sent
+        indexes := inputIndexes(values, key)
+        if n := len(indexes); n > 0 && indexes[n-1] != n-1 {
+            *errs = append(*errs, &FieldError{Field: key, Message: "indexes must count from 0 without gaps"})
+            return
+        }
+
+        s := reflect.MakeSlice(t, len(indexes), len(indexes))
+        for i, n := range indexes {
+            bindStruct(s.Index(i), values, fmt.Sprintf("%s.%d.", key, n), errs)
+        }
+        v.Set(s)
+
+    case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+        vals := values[key]
+        if len(vals) == 0 {
+            vals = values[key+"[]"]
+        }
+
+        s := reflect.MakeSlice(t, len(vals), len(vals))
+        for i, str := range vals {
+            if e := setValue(s.Index(i), str, layout); e != nil {
+                *errs = append(*errs, &FieldError{Field: fmt.Sprintf("%s.%d", key, i), Message: e.Error()})
+            }
+        }
+        v.Set(s)
+
+    default:
+        if vals := values[key]; len(vals) > 0 {
+            if e := setValue(v, vals[0], layout); e != nil {
+                *errs = append(*errs, &FieldError{Field: key, Message: e.Error()})
+            }
+        }
+    }
+}
+
+/**
+ * hasInput tells if there is any value for key or under it
+ */
+func hasInput(values url.Values, key string) bool {
+    if _, has := values[key]; has {
+        return true
+    }
+
+    if _, has := values[key+"[]"]; has {
+        return true
+    }
+
+    for k := range values {
+        if strings.HasPrefix(k, key+".") {
+            return true
+        }
+    }
+
+    return false
+}
+
+/**
+ * inputIndexes returns the sorted indexes found in keys like key.N.field
+ */
+func inputIndexes(values url.Values, key string) []int {
+    seen := make(map[int]bool)
+    for k := range values {
+        if !strings.HasPrefix(k, key+".") {
+            continue
+        }
+
+        rest := k[len(key)+1:]
+        if i := strings.Index(rest, "."); i > 0 {
+            rest = rest[:i]
+        }
+
+        if n, e := strconv.Atoi(rest); e == nil && n >= 0 {
+            seen[n] = true
+        }
+    }
+
+    indexes := make([]int, 0, len(seen))
+    for n := range seen {
+        indexes = append(indexes, n)
+    }
+    sort.Ints(indexes)
+
+    return indexes
+}
+
+/**
+ * setValue converts s to the type of v
+ * by the same rules as the typed accessors of Request
+ */
+func setValue(v reflect.Value, s string, layout string) error {
+    switch v.Type() {
+    case timeType:
+        t, e := parseTime(s, layout)
+        if e != nil {
+            return e
+        }
+        v.Set(reflect.ValueOf(t))
+        return nil
+
+    case durationType:
+        d, e := time.ParseDuration(s)
+        if e != nil {
+            return errors.New("must be a duration like 1h30m")
+        }
+        v.SetInt(int64(d))
+        return nil
+    }
+
+    if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+        return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+    }
+
+    switch v.Kind() {
+    case reflect.String:
+        v.SetString(s)
+
+    case reflect.Bool:
+        b, e := parseBool(s)
+        if e != nil {
+            return e
+        }
+        v.SetBool(b)
+
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        i, e := strconv.ParseInt(s, 10, v.Type().Bits())
+        if e != nil {
+            return errors.New("must be an integer")
+        }
+        v.SetInt(i)
+
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        u, e := strconv.ParseUint(s, 10, v.Type().Bits())
+        if e != nil {
+            return errors.New("must be a positive integer")
+        }
+        v.SetUint(u)
+
+    case reflect.Float32, reflect.Float64:
+        f, e := strconv.ParseFloat(s, v.Type().Bits())
+        if e != nil {
+            return errors.New("must be a number")
+        }
+        v.SetFloat(f)
+
+    default:
+        return fmt.Errorf("unsupported type %s", v.Type())
+    }
+
+    return nil
+}
+
+/**
+ * parseBool accepts what strconv does plus on/off and yes/no from forms
+ */
+func parseBool(s string) (bool, error) {
+    switch strings.ToLower(s) {
+    case "on", "yes":
+        return true, nil
+    case "off", "no", "":
+        return false, nil
+    }
+
+    b, e := strconv.ParseBool(s)
+    if e != nil {
+        return false, errors.New("must be a boolean")
+    }
+
+    return b, nil
+}
+
+func parseTime(s, layout string) (time.Time, error) {
+    if len(layout) > 0 {
+        t, e := time.Parse(layout, s)
+        if e != nil {
+            return t, errors.New("must be a time like " + layout)
+        }
+        return t, nil
+    }
+
+    for _, l := range TimeLayouts {
+        if t, e := time.Parse(l, s); e == nil {
+            return t, nil
+        }
+    }
+
+    return time.Time{}, errors.New("must be a time like " + TimeLayouts[0])
+}
@@ -0,0 +1,184 @@
+package potato
+
+import (
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+func jsonRequest(body string) *Request {
+    hr := httptest.NewRequest("POST", "/", strings.NewReader(body))
+    hr.Header.Set("Content-Type", "application/json")
+    return NewRequest(hr, nil)
+}
+
+func TestBindJsonTooLarge(t *testing.T) {
+    defer func(n int64) { MaxJsonSize = n }(MaxJsonSize)
+    MaxJsonSize = 16
+
+    var form struct {
+        Name string `json:"name"`
+    }
+
+    if e := jsonRequest(`{"name":"` + strings.Repeat("x", 32) + `"}`).Bind(&form); e != ErrBodyTooLarge {
+        t.Fatalf("got %v", e)
+    }
+
+    if e := jsonRequest(`{"name":"bob"}`).Bind(&form); e != nil || form.Name != "bob" {
+        t.Fatalf("got %q %v", form.Name, e)
+    }
+}
+
+type bindAddress struct {
+    City string `form:"city" validate:"required"`
+    Zip  string `form:"zip"`
+}
+
+type bindItem struct {
+    Name string `form:"name" validate:"required"`
+    Qty  int    `form:"qty" validate:"min=1"`
+}
+
+type bindForm struct {
+    Name     string        `form:"name" validate:"required,min=2"`
+    Age      *int          `form:"age"`
+    Tags     []string      `form:"tags"`
+    Born     time.Time     `form:"born" time_format:"2006-01-02"`
+    Seen     time.Time     `form:"seen"`
+    Wait     time.Duration `form:"wait"`
+    Active   bool          `form:"active"`
+    Address  bindAddress   `form:"address"`
+    Items    []bindItem    `form:"items"`
+    Manager  *bindAddress  `form:"manager"`
+    Skipped  string        `form:"-"`
+    internal string
+}
+
+func formRequest(query string, body url.Values, params map[string]string) *Request {
+    hr := httptest.NewRequest("POST", "/?"+query, strings.NewReader(body.Encode()))
+    hr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    return NewRequest(hr, params)
+}
+
+func TestBindForm(t *testing.T) {
+    body := url.Values{
+        "name":         {"bob"},
+        "age":          {"30"},
+        "tags[]":       {"a", "b"},
+        "born":         {"1990-02-03"},
+        "seen":         {"2020-01-02 03:04:05"},
+        "wait":         {"1h30m"},
+        "active":       {"on"},
+        "address.city": {"paris"},
+        "items.0.name": {"pen"},
+        "items.0.qty":  {"2"},
+        "items.1.name": {"ink"},
+        "items.1.qty":  {"5"},
+        "manager.city": {"rome"},
+        "Skipped":      {"x"},
+    }
+
+    form := &bindForm{}
+    if e := formRequest("", body, nil).Bind(form); e != nil {
+        t.Fatal(e)
+    }
+
+    if form.Name != "bob" || form.Age == nil || *form.Age != 30 || len(form.Tags) != 2 || form.Tags[1] != "b" {
+        t.Errorf("got name %q age %v tags %v", form.Name, form.Age, form.Tags)
+    }
+    if form.Born.Format("2006-01-02") != "1990-02-03" || form.Seen.Hour() != 3 || form.Wait != 90*time.Minute || !form.Active {
+        t.Errorf("got born %v seen %v wait %v active %v", form.Born, form.Seen, form.Wait, form.Active)
+    }
+    if form.Address.City != "paris" || form.Manager == nil || form.Manager.City != "rome" {
+        t.Errorf("got address %+v manager %+v", form.Address, form.Manager)
+    }
+    if len(form.Items) != 2 || form.Items[0].Name != "pen" || form.Items[1].Qty != 5 {
+        t.Errorf("got items %+v", form.Items)
+    }
+    if len(form.Skipped) > 0 {
+        t.Error("field with form:\"-\" bound")
+    }
+}
+
+func TestBindParamsWin(t *testing.T) {
+    form := &bindForm{}
+    r := formRequest("name=query", url.Values{"name": {"body"}, "address.city": {"x"}}, map[string]string{"name": "param"})
+    if e := r.Bind(form); e != nil || form.Name != "param" {
+        t.Fatalf("got %q %v", form.Name, e)
+    }
+}
+
+func TestBindErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        body url.Values
+        errs map[string]string
+    }{
+        {"missing", url.Values{"address.zip": {"1"}}, map[string]string{
+            "name":         "is required",
+            "address.city": "is required",
+        }},
+        {"types", url.Values{"name": {"bob"}, "address.city": {"x"}, "age": {"old"}, "wait": {"long"}, "born": {"02/03/1990"}}, map[string]string{
+            "age":  "must be an integer",
+            "wait": "must be a duration like 1h30m",
+            "born": "must be a time like 2006-01-02",
+        }},
+        {"items", url.Values{"name": {"bob"}, "address.city": {"x"}, "items.0.name": {"pen"}, "items.0.qty": {"0"}, "items.1.qty": {"x"}}, map[string]string{
+            "items.0.qty":  "",
+            "items.1.qty":  "must be an integer",
+            "items.1.name": "is required",
+        }},
+        {"gaps", url.Values{"name": {"bob"}, "address.city": {"x"}, "items.0.name": {"pen"}, "items.5.qty": {"0"}}, map[string]string{
+            "items": "indexes must count from 0 without gaps",
+        }},
+    }
+
+    for _, test := range tests {
+        got := ErrorMap(formRequest("", test.body, nil).Bind(&bindForm{}))
+        if len(got) != len(test.errs) {
+            t.Errorf("%s: got %v", test.name, got)
+            continue
+        }
+
+        for k, msg := range test.errs {
+            if m, has := got[k]; !has || len(msg) > 0 && m != msg {
+                t.Errorf("%s: %s got %q, want %q", test.name, k, m, msg)
+            }
+        }
+    }
+}
+
+func TestBindJson(t *testing.T) {
+    var form struct {
+        Name  string     `json:"name" validate:"required"`
+        Items []bindItem `json:"items"`
+        Page  int        `form:"page"`
+    }
+
+    hr := httptest.NewRequest("POST", "/?page=3", strings.NewReader(`{"name":"bob","items":[{"Name":"pen","Qty":2}]}`))
+    hr.Header.Set("Content-Type", "application/vnd.api+json")
+    if e := NewRequest(hr, nil).Bind(&form); e != nil {
+        t.Fatal(e)
+    }
+    if form.Name != "bob" || len(form.Items) != 1 || form.Items[0].Qty != 2 || form.Page != 3 {
+        t.Fatalf("got %+v", form)
+    }
+
+    got := ErrorMap(jsonRequest(`{"name":5}`).Bind(&form))
+    if got["name"] != "must be string" {
+        t.Fatalf("got %v", got)
+    }
+
+    if got := ErrorMap(jsonRequest(`{"name":`).Bind(&form)); len(got[""]) == 0 {
+        t.Fatalf("broken json got %v", got)
+    }
+}
+
+func TestBindNeedsStructPointer(t *testing.T) {
+    var form bindForm
+    if e := formRequest("", nil, nil).Bind(form); e == nil {
+        t.Fatal("bound a struct value")
+    }
+}
@@ -1,8 +1,10 @@
 package potato
 
 import (
-    ws "code.google.com/p/go.net/websocket"
+    "bytes"
     "encoding/json"
+    ws "github.com/roydong/potato/websocket"
+    "html/template"
     "net/http"
     "reflect"
 )
@@ -33,12 +35,18 @@ func (c *Controller) RenderText(t string) {
     c.Response.Sent = true
 }
 
+/**
+ * Render renders the template in the layout
+ * pages are rendered into a buffer before writing, so template funcs
+ * like csrf_token may still create the session and set its cookie
+ */
 func (c *Controller) Render(name string, data interface{}) {
     if t := T.Template(c.Layout); t != nil {
         html := NewHtml()
         html.Data = data
+        html.request = c.Request
         html.Content = T.Include(name, html)
-        t.Execute(c.Response, html)
+        c.execute(t, html)
         c.Response.Sent = true
     } else {
         panic(c.Layout + " template not found")
@@ -47,16 +55,25 @@ func (c *Controller) Render(name string, data interface{}) {
 
 func (c *Controller) RenderPartial(name string, data interface{}) {
     if t := T.Template(name); t != nil {
-        t.Execute(c.Response, data)
+        c.execute(t, data)
     } else {
         panic(name + " template not found")
     }
 }
 
+func (c *Controller) execute(t *template.Template, data interface{}) {
+    buf := new(bytes.Buffer)
+    if e := t.Execute(buf, data); e != nil {
+        L.Error("could not render template", "template", t.Name(), "error", e)
+    }
+
+    c.Response.Write(buf.Bytes())
+}
+
 func (c *Controller) RenderJson(v interface{}) {
     json, e := json.Marshal(v)
     if e != nil {
-        L.Println(e)
+        L.Error("could not encode json", "error", e)
     }
 
     c.Response.Header().Set("Content-Type", "application/json; charset=utf8")
@@ -64,30 +81,66 @@ func (c *Controller) RenderJson(v interface{}) {
     c.Response.Sent = true
 }
 
-func (c *Controller) WSReceive() string {
-    var txt string
-    if e := ws.Message.Receive(c.Request.WSConn, &txt); e != nil {
-        L.Println(e)
-        return ""
-    }
+/**
+ * WSReceive returns the next text or binary message as string
+ * the error is *websocket.CloseError when the connection is closed
+ * by peer, timeout or a too big message
+ */
+func (c *Controller) WSReceive() (string, error) {
+    _, data, e := c.Request.WSConn.ReadMessage()
+    return string(data), e
+}
 
-    return txt
+/**
+ * WSReceiveMessage returns the next message with its type
+ */
+func (c *Controller) WSReceiveMessage() (int, []byte, error) {
+    return c.Request.WSConn.ReadMessage()
 }
 
-func (c *Controller) WSSend(txt string) bool {
-    if e := ws.Message.Send(c.Request.WSConn, txt); e != nil {
-        L.Println(e)
-        return false
-    }
+/**
+ * WSSend queues txt on the send queue of current connection
+ * websocket.ErrQueueFull is returned if the client reads too slow
+ */
+func (c *Controller) WSSend(txt string) error {
+    return c.Request.WSConn.Send(ws.TextMessage, []byte(txt))
+}
 
-    return true
+func (c *Controller) WSSendBinary(data []byte) error {
+    return c.Request.WSConn.Send(ws.BinaryMessage, data)
 }
 
-func (c *Controller) WSSendJson(v interface{}) bool {
-    if e := ws.JSON.Send(c.Request.WSConn, v); e != nil {
-        L.Println(e)
-        return false
+func (c *Controller) WSSendJson(v interface{}) error {
+    data, e := json.Marshal(v)
+    if e != nil {
+        return e
     }
 
-    return true
+    return c.Request.WSConn.Send(ws.TextMessage, data)
+}
+
+/**
+ * WSJoin puts the current connection into the room of hub H
+ */
+func (c *Controller) WSJoin(room string) {
+    H.Join(room, c.Request.WSConn)
+}
+
+func (c *Controller) WSLeave(room string) {
+    H.Leave(room, c.Request.WSConn)
+}
+
+/**
+ * WSPresence sets the presence value of the current connection
+ */
+func (c *Controller) WSPresence(v interface{}) {
+    H.SetPresence(c.Request.WSConn, v)
+}
+
+func (c *Controller) WSBroadcast(room, txt string) int {
+    return H.Broadcast(room, txt)
+}
+
+func (c *Controller) WSBroadcastJson(room string, v interface{}) int {
+    return H.BroadcastJson(room, v)
 }
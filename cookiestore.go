@@ -0,0 +1,184 @@
+package potato
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+    "time"
+)
+
+const (
+    //browsers keep at least 4096 bytes for name, value and attributes
+    MaxCookieSize = 4096
+)
+
+var (
+    ErrNoSessionKey = errors.New("potato: cookie session needs at least one key")
+)
+
+/**
+ * SessionTooLargeError is returned when a session
+ * can not be put into the cookie
+ */
+type SessionTooLargeError struct {
+    Size int
+}
+
+func (e *SessionTooLargeError) Error() string {
+    return fmt.Sprintf("potato: session cookie is %d bytes, over the limit of %d,"+
+        " store less data in session or use a server side store", e.Size, MaxCookieSize)
+}
+
+type cookieKey struct {
+    sign []byte
+    aead cipher.AEAD
+}
+
+/**
+ * CookieStore keeps the whole session in the session cookie
+ * the serialized session is signed with HMAC-SHA256 and
+ * encrypted with AES-GCM if Encrypt is set
+ * the first key signs, all keys verify, so keys can be rotated
+ * by putting a new key in front and dropping the oldest later
+ */
+type CookieStore struct {
+    Encrypt bool
+    keys    []*cookieKey
+}
+
+func NewCookieStore(keys []string, encrypt bool) (*CookieStore, error) {
+    if len(keys) == 0 {
+        return nil, ErrNoSessionKey
+    }
+
+    c := &CookieStore{Encrypt: encrypt}
+    for _, k := range keys {
+        sign := sha256.Sum256([]byte("potato session sign " + k))
+        enc := sha256.Sum256([]byte("potato session encrypt " + k))
+
+        block, e := aes.NewCipher(enc[:])
+        if e != nil {
+            return nil, e
+        }
+
+        aead, e := cipher.NewGCM(block)
+        if e != nil {
+            return nil, e
+        }
+
+        c.keys = append(c.keys, &cookieKey{sign[:], aead})
+    }
+
+    return c, nil
+}
+
+/**
+ * Load decodes the session from the cookie value
+ * values not signed by any key are ignored
+ */
+func (c *CookieStore) Load(value string) (*Session, error) {
+    parts := strings.Split(value, ".")
+    if len(parts) != 2 {
+        return nil, nil
+    }
+
+    sig, e := base64.RawURLEncoding.DecodeString(parts[1])
+    if e != nil {
+        return nil, nil
+    }
+
+    for _, k := range c.keys {
+        if !hmac.Equal(sig, k.mac(parts[0])) {
+            continue
+        }
+
+        data, e := base64.RawURLEncoding.DecodeString(parts[0])
+        if e != nil {
+            return nil, nil
+        }
+
+        if c.Encrypt {
+            n := k.aead.NonceSize()
+            if len(data) < n {
+                return nil, nil
+            }
+
+            if data, e = k.aead.Open(nil, data[:n], data[n:], nil); e != nil {
+                return nil, nil
+            }
+        }
+
+        return UnmarshalSession(data)
+    }
+
+    return nil, nil
+}
+
+/**
+ * Encode serializes, encrypts and signs the session with the newest key
+ */
+func (c *CookieStore) Encode(s *Session) (string, error) {
+    data, e := s.Marshal()
+    if e != nil {
+        return "", e
+    }
+
+    k := c.keys[0]
+    if c.Encrypt {
+        nonce := make([]byte, k.aead.NonceSize())
+        if _, e := io.ReadFull(rand.Reader, nonce); e != nil {
+            return "", e
+        }
+
+        data = k.aead.Seal(nonce, nonce, data, nil)
+    }
+
+    payload := base64.RawURLEncoding.EncodeToString(data)
+    value := payload + "." + base64.RawURLEncoding.EncodeToString(k.mac(payload))
+
+    //leave some room for the cookie attributes
+    if size := len(SessionCookieName) + len(value) + 100; size > MaxCookieSize {
+        return "", &SessionTooLargeError{size}
+    }
+
+    return value, nil
+}
+
+/**
+ * Check tells if the session fits in the cookie, controllers may call it
+ * after storing large data, as the cookie is written after the action
+ * and a session too large is dropped there
+ */
+func (c *CookieStore) Check(s *Session) error {
+    _, e := c.Encode(s)
+    return e
+}
+
+/**
+ * Save, Delete and GC have nothing to do
+ * the cookie is written by the router before the header is sent
+ */
+func (c *CookieStore) Save(s *Session) error {
+    return nil
+}
+
+func (c *CookieStore) Delete(id string) error {
+    return nil
+}
+
+func (c *CookieStore) GC(maxIdle time.Duration) error {
+    return nil
+}
+
+func (k *cookieKey) mac(payload string) []byte {
+    h := hmac.New(sha256.New, k.sign)
+    h.Write([]byte(SessionCookieName + "|" + payload))
+    return h.Sum(nil)
+}
@@ -0,0 +1,171 @@
+package potato
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func cookieSession() *Session {
+    s := newTestSession()
+    s.Set("user", "bob", true)
+    return s
+}
+
+func TestCookieStoreRoundTrip(t *testing.T) {
+    for _, encrypt := range []bool{false, true} {
+        c, e := NewCookieStore([]string{"k1"}, encrypt)
+        if e != nil {
+            t.Fatal(e)
+        }
+
+        s := cookieSession()
+        value, e := c.Encode(s)
+        if e != nil {
+            t.Fatal(e)
+        }
+
+        got, e := c.Load(value)
+        if e != nil || got == nil {
+            t.Fatalf("encrypt %v: load got %v %v", encrypt, got, e)
+        }
+
+        if v, _ := got.String("user"); v != "bob" || got.Id != s.Id {
+            t.Errorf("encrypt %v: got %q %s", encrypt, v, got.Id)
+        }
+
+        //the same session encrypts differently every time
+        if encrypt {
+            again, _ := c.Encode(s)
+            if again == value {
+                t.Error("nonce reused")
+            }
+        }
+    }
+}
+
+func TestCookieStoreEncryptHidesData(t *testing.T) {
+    c, _ := NewCookieStore([]string{"k1"}, true)
+    s := cookieSession()
+    s.Set("secret", "plaintextvalue", true)
+    value, _ := c.Encode(s)
+
+    if strings.Contains(value, "plaintextvalue") {
+        t.Fatal("data readable in cookie")
+    }
+
+    //a signed but not encrypted cookie is refused by an encrypting store
+    plain, _ := NewCookieStore([]string{"k1"}, false)
+    signed, _ := plain.Encode(s)
+    if got, _ := c.Load(signed); got != nil {
+        t.Fatal("unencrypted cookie loaded")
+    }
+}
+
+func TestCookieStoreTampered(t *testing.T) {
+    for _, encrypt := range []bool{false, true} {
+        c, _ := NewCookieStore([]string{"k1"}, encrypt)
+        value, _ := c.Encode(cookieSession())
+        dot := strings.Index(value, ".")
+
+        flip := func(i int) string {
+            b := []byte(value)
+            if b[i] == 'A' {
+                b[i] = 'B'
+            } else {
+                b[i] = 'A'
+            }
+            return string(b)
+        }
+
+        tests := []string{
+            flip(0),
+            flip(dot - 1),
+            flip(dot + 1),
+            flip(len(value) - 2),
+            value[:dot],
+            value + ".x",
+            "",
+            "not base64!.sig",
+        }
+
+        for _, v := range tests {
+            if got, _ := c.Load(v); got != nil {
+                t.Errorf("encrypt %v: tampered %q loaded", encrypt, v)
+            }
+        }
+    }
+}
+
+func TestCookieStoreKeyRotation(t *testing.T) {
+    for _, encrypt := range []bool{false, true} {
+        old, _ := NewCookieStore([]string{"old"}, encrypt)
+        value, _ := old.Encode(cookieSession())
+
+        rotated, _ := NewCookieStore([]string{"new", "old"}, encrypt)
+        got, _ := rotated.Load(value)
+        if got == nil {
+            t.Fatalf("encrypt %v: old cookie not verified after rotation", encrypt)
+        }
+
+        //new cookies are signed by the new key only
+        value, _ = rotated.Encode(got)
+        if s, _ := old.Load(value); s != nil {
+            t.Errorf("encrypt %v: new cookie signed by old key", encrypt)
+        }
+
+        dropped, _ := NewCookieStore([]string{"new"}, encrypt)
+        if s, _ := dropped.Load(value); s == nil {
+            t.Errorf("encrypt %v: new cookie not verified by new key", encrypt)
+        }
+
+        other, _ := NewCookieStore([]string{"other"}, encrypt)
+        if s, _ := other.Load(value); s != nil {
+            t.Errorf("encrypt %v: cookie verified by wrong key", encrypt)
+        }
+    }
+}
+
+func TestCookieStoreTooLarge(t *testing.T) {
+    c, _ := NewCookieStore([]string{"k1"}, true)
+    s := cookieSession()
+    s.Set("big", strings.Repeat("x", MaxCookieSize), true)
+
+    _, e := c.Encode(s)
+    if te, ok := e.(*SessionTooLargeError); !ok || te.Size <= MaxCookieSize {
+        t.Fatalf("got %v", e)
+    }
+
+    if e := c.Check(s); e == nil {
+        t.Fatal("check passed a session too large")
+    }
+}
+
+func TestCookieTooLargeExpired(t *testing.T) {
+    old := SessionStorage
+    c, _ := NewCookieStore([]string{"k1"}, false)
+    SessionStorage = c
+    defer func() { SessionStorage = old }()
+
+    s := cookieSession()
+    s.Set("user", "bob", true)
+    value, _ := c.Encode(s)
+
+    r, p, w := sessionRequest(value)
+    if v, _ := r.Session.String("user"); v != "bob" {
+        t.Fatal("cookie session not loaded")
+    }
+    r.Session.Set("big", strings.Repeat("x", MaxCookieSize), true)
+    p.WriteHeader(http.StatusOK)
+
+    cookies := w.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+        t.Fatalf("got cookies %v, want the old one expired", cookies)
+    }
+}
+
+func TestCookieStoreNoKey(t *testing.T) {
+    if _, e := NewCookieStore(nil, false); e != ErrNoSessionKey {
+        t.Fatalf("got %v", e)
+    }
+}
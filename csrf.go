@@ -0,0 +1,118 @@
+package potato
+
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "fmt"
+    "html/template"
+    "net/http"
+)
+
+const (
+    CSRFHeader    = "X-CSRF-Token"
+    CSRFFieldName = "_csrf"
+
+    csrfKey = "_csrf"
+)
+
+var (
+    //unsafe requests without a valid token are rejected with 403
+    //unless the route or its prefix has csrf_exempt
+    CSRFEnabled = true
+)
+
+/**
+ * CSRFToken returns the token of current session
+ * a token is created along with the session if there is none
+ */
+func (r *Request) CSRFToken() string {
+    if t, ok := r.Session.String(csrfKey); ok && len(t) > 0 {
+        return t
+    }
+
+    rnd := make([]byte, 32)
+    if _, e := rand.Read(rnd); e != nil {
+        panic("could not get random chars while creating csrf token")
+    }
+
+    t := base64.RawURLEncoding.EncodeToString(rnd)
+    r.Session.Set(csrfKey, t, true)
+    return t
+}
+
+/**
+ * checkCSRF tells if the request may go on
+ * safe methods always pass, others need the token in
+ * X-CSRF-Token header, which is how ajax requests send it,
+ * or in the _csrf form field
+ * routes with no_session and clients with bearer tokens pass since they
+ * have no session to keep a token in, basic auth is still checked
+ * as browsers resend cached credentials on cross-site posts
+ */
+func checkCSRF(r *Request) bool {
+    if !CSRFEnabled || r.Route.CSRFExempt || r.Route.NoSession || r.bearerAuth {
+        return true
+    }
+
+    switch r.Method {
+    case "GET", "HEAD", "OPTIONS", "TRACE":
+        return true
+    }
+
+    expect, _ := r.Session.String(csrfKey)
+    if len(expect) == 0 {
+        return false
+    }
+
+    token := r.Header.Get(CSRFHeader)
+    if len(token) == 0 {
+        token = r.FormValue(CSRFFieldName)
+    }
+
+    return subtle.ConstantTimeCompare([]byte(token), []byte(expect)) == 1
+}
+
+/**
+ * csrf runs before dispatching, it rejects forged requests
+ * and gives ajax requests the token in the response header
+ */
+func csrf(r *Request, p *Response) bool {
+    if !checkCSRF(r) {
+        L.Warn("csrf token mismatch", "route", r.Route.Name,
+            "method", r.Method, "path", r.URL.Path)
+        http.Error(p, "invalid csrf token", http.StatusForbidden)
+        return false
+    }
+
+    if CSRFEnabled && r.IsAjax() {
+        if t, ok := r.Session.String(csrfKey); ok {
+            p.Header().Set(CSRFHeader, t)
+        }
+    }
+
+    return true
+}
+
+/**
+ * CSRFField writes the hidden input with the token in forms
+ *
+ *     <form method="post">{{csrf_field .}}...</form>
+ */
+func (t *Template) CSRFField(h *Html) template.HTML {
+    return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s"/>`,
+        CSRFFieldName, template.HTMLEscapeString(t.CSRFToken(h))))
+}
+
+/**
+ * CSRFToken is for meta tags read by ajax code
+ *
+ *     <meta name="csrf-token" content="{{csrf_token .}}"/>
+ */
+func (t *Template) CSRFToken(h *Html) string {
+    if h == nil || h.request == nil {
+        return ""
+    }
+
+    return h.request.CSRFToken()
+}
@@ -0,0 +1,91 @@
+package potato
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+)
+
+type pageController struct {
+    Controller
+}
+
+func (c *pageController) Show() {
+    c.Render("show", nil)
+}
+
+func (c *pageController) Save() {
+    c.RenderText("saved")
+}
+
+func pageRouter(t *testing.T) *Router {
+    dir := t.TempDir() + "/"
+    os.WriteFile(dir+"layout.html", []byte(`<meta name="csrf-token" content="{{csrf_token .}}"/>{{.Content}}`), 0644)
+    os.WriteFile(dir+"show.html", []byte(`<p>page</p>`), 0644)
+    T = NewTemplate(dir)
+    T.SetFuncs(nil)
+
+    rt := NewRouter()
+    rt.SetControllers(map[string]interface{}{"page": &pageController{}})
+    rt.routes = []*PrefixedRoutes{{
+        Prefix: "",
+        Routes: []*Route{
+            {Name: "show", Controller: "page", Action: "Show", Pattern: "/show"},
+            {Name: "save", Controller: "page", Action: "Save", Pattern: "/save"},
+            {Name: "hook", Controller: "page", Action: "Save", Pattern: "/hook", NoSession: true},
+        },
+    }}
+    rt.initRoutes()
+    return rt
+}
+
+func TestCSRFTokenInLayoutSetsCookie(t *testing.T) {
+    rt := pageRouter(t)
+    w := httptest.NewRecorder()
+    rt.ServeHTTP(w, httptest.NewRequest("GET", "/show", nil))
+
+    cookies := w.Result().Cookies()
+    if len(cookies) == 0 || cookies[0].Name != SessionCookieName {
+        t.Fatal("no session cookie for the page with csrf token")
+    }
+
+    s, _ := SessionStorage.Load(cookies[0].Value)
+    if s == nil {
+        t.Fatal("session not saved")
+    }
+    token, _ := s.String(csrfKey)
+    if !strings.Contains(w.Body.String(), token) {
+        t.Fatalf("token %q not in page %q", token, w.Body.String())
+    }
+
+    post := func(token string) int {
+        r := httptest.NewRequest("POST", "/save", nil)
+        r.AddCookie(cookies[0])
+        if len(token) > 0 {
+            r.Header.Set(CSRFHeader, token)
+        }
+        w := httptest.NewRecorder()
+        rt.ServeHTTP(w, r)
+        return w.Code
+    }
+
+    if code := post(token); code != http.StatusOK {
+        t.Errorf("post with token got %d", code)
+    }
+    if code := post(""); code != http.StatusForbidden {
+        t.Errorf("post without token got %d", code)
+    }
+    if code := post("wrong"); code != http.StatusForbidden {
+        t.Errorf("post with wrong token got %d", code)
+    }
+}
+
+func TestCSRFSkipsNoSessionRoutes(t *testing.T) {
+    w := httptest.NewRecorder()
+    pageRouter(t).ServeHTTP(w, httptest.NewRequest("POST", "/hook", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("post to no_session route got %d", w.Code)
+    }
+}
@@ -0,0 +1,116 @@
+package potato
+
+const (
+    flashKey = "_flash"
+)
+
+/**
+ * Flash is a message shown once on the next page, like "saved successfully"
+ * Kind is for styling, such as success, info or error
+ */
+type Flash struct {
+    Kind    string
+    Message string
+}
+
+/**
+ * Flash adds a message to the session for the next request
+ */
+func (c *Controller) Flash(kind, msg string) {
+    r := c.Request
+    r.loadFlashes()
+    list, _ := r.Session.Value(flashKey).([]interface{})
+
+    //kept as basic types so it survives any session store
+    list = append(list, map[interface{}]interface{}{
+        "kind":    kind,
+        "message": msg,
+    })
+
+    r.Session.Set(flashKey, list, true)
+}
+
+/**
+ * loadFlashes counts the messages added by previous requests once,
+ * they are in front of the ones added by this request
+ */
+func (r *Request) loadFlashes() {
+    if r.flashes == nil {
+        r.flashes = make([]*Flash, 0)
+        list, _ := r.Session.Value(flashKey).([]interface{})
+        r.oldFlashes = len(list)
+    }
+}
+
+/**
+ * Flashes returns the messages added by previous requests
+ * and only kinds listed are returned if any
+ * the messages returned are removed from the session, the others
+ * and the ones added by this request are kept for the next request
+ */
+func (r *Request) Flashes(kinds ...string) []*Flash {
+    r.loadFlashes()
+    list, _ := r.Session.Value(flashKey).([]interface{})
+    if r.oldFlashes > len(list) {
+        r.oldFlashes = len(list)
+    }
+
+    keep := make([]interface{}, 0, len(list))
+    for i, v := range list {
+        if i < r.oldFlashes {
+            m, ok := v.(map[interface{}]interface{})
+            if !ok {
+                continue
+            }
+
+            kind, _ := m["kind"].(string)
+            msg, _ := m["message"].(string)
+            f := &Flash{kind, msg}
+            if f.is(kinds) {
+                r.flashes = append(r.flashes, f)
+                continue
+            }
+        }
+
+        keep = append(keep, v)
+    }
+
+    if n := len(list) - len(keep); n > 0 {
+        r.oldFlashes -= n
+        if len(keep) > 0 {
+            r.Session.Set(flashKey, keep, true)
+        } else {
+            r.Session.Delete(flashKey)
+        }
+    }
+
+    return filterFlashes(r.flashes, kinds)
+}
+
+/**
+ * is tells if the flash is any of the kinds, or all kinds if none listed
+ */
+func (f *Flash) is(kinds []string) bool {
+    if len(kinds) == 0 {
+        return true
+    }
+
+    for _, k := range kinds {
+        if f.Kind == k {
+            return true
+        }
+    }
+
+    return false
+}
+
+func filterFlashes(flashes []*Flash, kinds []string) []*Flash {
+    list := make([]*Flash, 0, len(flashes))
+    for _, f := range flashes {
+        if f.is(kinds) {
+            list = append(list, f)
+        }
+    }
+
+    return list
+}
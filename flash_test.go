@@ -0,0 +1,84 @@
+package potato
+
+import (
+    "os"
+    "testing"
+)
+
+func flashMessages(flashes []*Flash) []string {
+    msgs := make([]string, 0, len(flashes))
+    for _, f := range flashes {
+        msgs = append(msgs, f.Kind+":"+f.Message)
+    }
+
+    return msgs
+}
+
+func TestFlashesNextRequest(t *testing.T) {
+    old := SessionStorage
+    SessionStorage = NewMemoryStore()
+    defer func() { SessionStorage = old }()
+
+    //added now, shown on the next request
+    r, _, _ := sessionRequest("")
+    c := &Controller{Request: r}
+    c.Flash("info", "saved")
+    c.Flash("error", "failed")
+    if got := r.Flashes(); len(got) != 0 {
+        t.Fatalf("flashes of this request consumed %v", flashMessages(got))
+    }
+    SaveSession(r.Session)
+    id := r.Session.CurrentId()
+
+    //a page showing errors only keeps the info
+    r, _, _ = sessionRequest(id)
+    c = &Controller{Request: r}
+    c.Flash("info", "again")
+    if got := flashMessages(r.Flashes("error")); len(got) != 1 || got[0] != "error:failed" {
+        t.Fatalf("got %v", got)
+    }
+    if got := flashMessages(r.Flashes("error")); len(got) != 1 {
+        t.Fatalf("second call got %v", got)
+    }
+    SaveSession(r.Session)
+
+    r, _, _ = sessionRequest(id)
+    got := flashMessages(r.Flashes())
+    if len(got) != 2 || got[0] != "info:saved" || got[1] != "info:again" {
+        t.Fatalf("got %v", got)
+    }
+    SaveSession(r.Session)
+
+    r, _, _ = sessionRequest(id)
+    if got := r.Flashes(); len(got) != 0 {
+        t.Fatalf("flashes shown twice %v", flashMessages(got))
+    }
+}
+
+func TestRenderKeepsFlashesNotShown(t *testing.T) {
+    old := SessionStorage
+    SessionStorage = NewMemoryStore()
+    defer func() { SessionStorage = old }()
+
+    dir := t.TempDir() + "/"
+    os.WriteFile(dir+"layout.html", []byte(`{{range flashes . "error"}}{{.Message}}{{end}}|{{.Content}}`), 0644)
+    os.WriteFile(dir+"show.html", []byte(`page`), 0644)
+    T = NewTemplate(dir)
+    T.SetFuncs(nil)
+
+    r, _, _ := sessionRequest("")
+    (&Controller{Request: r}).Flash("info", "saved")
+    (&Controller{Request: r}).Flash("error", "failed")
+    SaveSession(r.Session)
+
+    r, p, w := sessionRequest(r.Session.CurrentId())
+    c := &Controller{Request: r, Response: p, Layout: "layout"}
+    c.Render("show", nil)
+    if w.Body.String() != "failed|page" {
+        t.Fatalf("rendered %q", w.Body.String())
+    }
+
+    if got := flashMessages(r.Flashes("info")); len(got) != 1 || got[0] != "info:saved" {
+        t.Fatalf("kept %v", got)
+    }
+}
@@ -0,0 +1,130 @@
+package potato
+
+import (
+    "encoding/json"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+var (
+    //empty path disables the endpoint
+    HealthPath = "/healthz"
+    ReadyPath  = "/readyz"
+
+    //max time to wait for all ready checks
+    ReadyTimeout = 2 * time.Second
+
+    readyChecks = make(map[string]ReadyCheck)
+    readyLocker = &sync.Mutex{}
+    shutting    int32
+)
+
+/**
+ * ReadyCheck returns nil if the dependency it checks is ready
+ */
+type ReadyCheck func() error
+
+/**
+ * AddReadyCheck registers a named check used by the readiness endpoint
+ * registering the same name again replaces the old check
+ */
+func AddReadyCheck(name string, check ReadyCheck) {
+    readyLocker.Lock()
+    readyChecks[name] = check
+    readyLocker.Unlock()
+}
+
+func RemoveReadyCheck(name string) {
+    readyLocker.Lock()
+    delete(readyChecks, name)
+    readyLocker.Unlock()
+}
+
+/**
+ * ShuttingDown tells if the server is in graceful shutdown
+ */
+func ShuttingDown() bool {
+    return atomic.LoadInt32(&shutting) == 1
+}
+
+func setShuttingDown() {
+    atomic.StoreInt32(&shutting, 1)
+}
+
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+    writeProbe(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+/**
+ * serveReady runs all ready checks concurrently
+ * and responds 503 if any of them fails, times out
+ * or the server is shutting down
+ */
+func serveReady(w http.ResponseWriter, r *http.Request) {
+    if ShuttingDown() {
+        writeProbe(w, http.StatusServiceUnavailable,
+            map[string]interface{}{"status": "shutting down"})
+        return
+    }
+
+    readyLocker.Lock()
+    checks := make(map[string]ReadyCheck, len(readyChecks))
+    for k, c := range readyChecks {
+        checks[k] = c
+    }
+    readyLocker.Unlock()
+
+    type result struct {
+        name string
+        e    error
+    }
+
+    ch := make(chan result, len(checks))
+    for name, check := range checks {
+        go func(name string, check ReadyCheck) {
+            ch <- result{name, check()}
+        }(name, check)
+    }
+
+    status := http.StatusOK
+    results := make(map[string]string, len(checks))
+    for name := range checks {
+        results[name] = "timeout"
+    }
+
+    timeout := time.After(ReadyTimeout)
+    for i := 0; i < len(checks); i++ {
+        select {
+        case rs := <-ch:
+            if rs.e != nil {
+                results[rs.name] = rs.e.Error()
+            } else {
+                results[rs.name] = "ok"
+            }
+        case <-timeout:
+            i = len(checks)
+        }
+    }
+
+    for _, v := range results {
+        if v != "ok" {
+            status = http.StatusServiceUnavailable
+        }
+    }
+
+    state := "ok"
+    if status != http.StatusOK {
+        state = "not ready"
+    }
+
+    writeProbe(w, status, map[string]interface{}{"status": state, "checks": results})
+}
+
+func writeProbe(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json; charset=utf8")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
@@ -68,6 +68,20 @@ func (t *Template) Html(str string) template.HTML {
     return template.HTML(str)
 }
 
+/**
+ * Flashes lists flash messages in layouts rendered by Controller.Render
+ * only the kinds listed are taken from the session, others are kept
+ *
+ *     {{range flashes . "error"}}<p>{{.Message}}</p>{{end}}
+ */
+func (t *Template) Flashes(h *Html, kinds ...string) []*Flash {
+    if h == nil || h.request == nil {
+        return nil
+    }
+
+    return h.request.Flashes(kinds...)
+}
+
 func (t *Template) Potato() template.HTML {
     return template.HTML(fmt.Sprintf(`<a href="https://github.com/roydong/potato">Potato framework %s</a>`, Version))
 }
@@ -78,6 +92,10 @@ func (t *Template) SetFuncs(funcs map[string]interface{}) {
         "include": t.Include,
         "defined": t.Defined,
         "html":    t.Html,
+        "flashes": t.Flashes,
+
+        "csrf_field": t.CSRFField,
+        "csrf_token": t.CSRFToken,
     }
 
     for k, f := range funcs {
@@ -94,12 +112,14 @@ func (t *Template) SetFuncs(funcs map[string]interface{}) {
 func (t *Template) loadTemplateFiles(dir string) {
     d, e := os.Open(dir)
     if e != nil {
+        L.Warn("could not open template dir", "dir", dir, "error", e)
         return
     }
     defer d.Close()
 
     dinfo, e := d.Readdir(-1)
     if e != nil {
+        L.Warn("could not read template dir", "dir", dir, "error", e)
         return
     }
 
@@ -121,9 +141,14 @@ func (t *Template) loadTemplateFiles(dir string) {
                     key := strings.TrimPrefix(
                         strings.TrimSuffix(uri, ".html"), t.dir)
                     template.Must(t.root.New(key).Parse(string(txt)))
+                    L.Debug("template loaded", "name", key)
+                } else {
+                    L.Warn("could not read template", "file", uri, "error", e)
                 }
 
                 f.Close()
+            } else {
+                L.Warn("could not open template", "file", uri, "error", e)
             }
         }
     }
@@ -133,6 +158,7 @@ type Html struct {
     css, js   []string
     title     string
     fragments map[string]template.HTML
+    request   *Request
     Data      interface{}
     Content   template.HTML
 }
@@ -0,0 +1,77 @@
+package potato
+
+import (
+    "bufio"
+    "bytes"
+    "golang.org/x/crypto/bcrypt"
+    "strings"
+)
+
+/**
+ * Htpasswd keeps users and their bcrypt hashed passwords
+ * loaded from a file made by `htpasswd -B`
+ */
+type Htpasswd struct {
+    users map[string]string
+}
+
+/**
+ * LoadHtpasswd reads lines like user:$2y$10$...
+ * lines with other hash formats are skipped
+ */
+func LoadHtpasswd(filename string) (*Htpasswd, error) {
+    text, e := LoadFile(filename)
+    if e != nil {
+        return nil, e
+    }
+
+    h := &Htpasswd{make(map[string]string)}
+    scanner := bufio.NewScanner(bytes.NewReader(text))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if len(line) == 0 || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        parts := strings.SplitN(line, ":", 2)
+        if len(parts) != 2 {
+            continue
+        }
+
+        hash := parts[1]
+        if !strings.HasPrefix(hash, "$2y$") && !strings.HasPrefix(hash, "$2a$") &&
+            !strings.HasPrefix(hash, "$2b$") {
+            L.Warn("htpasswd: only bcrypt is supported", "file", filename, "user", parts[0])
+            continue
+        }
+
+        h.users[parts[0]] = hash
+    }
+
+    return h, scanner.Err()
+}
+
+func (h *Htpasswd) Check(user, pass string) bool {
+    hash, has := h.users[user]
+    if !has {
+        return false
+    }
+
+    return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+}
+
+/**
+ * basicUser is the current user of basic auth or bearer token
+ * when potato.Users is not set
+ */
+type basicUser struct {
+    name string
+}
+
+func (u *basicUser) UserId() string {
+    return u.name
+}
+
+func (u *basicUser) UserRoles() []string {
+    return nil
+}
@@ -0,0 +1,258 @@
+package potato
+
+import (
+    "encoding/json"
+    ws "github.com/roydong/potato/websocket"
+    "sync"
+)
+
+var (
+    H = NewHub()
+)
+
+/**
+ * Hub keeps all websocket connections and the rooms they joined
+ * every connection upgraded by the router is added to H
+ * and removed from it along with all its rooms on disconnect
+ * it is safe for concurrent use
+ */
+type Hub struct {
+    locker   sync.RWMutex
+    conns    map[*ws.Conn]map[string]bool
+    rooms    map[string]map[*ws.Conn]bool
+    presence map[*ws.Conn]interface{}
+}
+
+func NewHub() *Hub {
+    return &Hub{
+        conns:    make(map[*ws.Conn]map[string]bool),
+        rooms:    make(map[string]map[*ws.Conn]bool),
+        presence: make(map[*ws.Conn]interface{}),
+    }
+}
+
+func (h *Hub) Add(conn *ws.Conn) {
+    h.locker.Lock()
+    defer h.locker.Unlock()
+
+    if _, has := h.conns[conn]; !has {
+        h.conns[conn] = make(map[string]bool)
+    }
+}
+
+/**
+ * Remove takes the connection out of the hub and all rooms
+ */
+func (h *Hub) Remove(conn *ws.Conn) {
+    h.locker.Lock()
+    defer h.locker.Unlock()
+
+    for room := range h.conns[conn] {
+        h.leave(room, conn)
+    }
+
+    delete(h.conns, conn)
+    delete(h.presence, conn)
+}
+
+/**
+ * CloseAll closes every connection in the hub with the close code
+ * the router removes them from the hub as their handlers return
+ */
+func (h *Hub) CloseAll(code int, text string) {
+
+    //peers slow to take the close frame must not hold the others
+    for _, conn := range h.all() {
+        go conn.CloseWith(code, text)
+    }
+}
+
+/**
+ * Join puts the connection into the room, room is created if not exists
+ */
+func (h *Hub) Join(room string, conn *ws.Conn) {
+    h.locker.Lock()
+    defer h.locker.Unlock()
+
+    rooms, has := h.conns[conn]
+    if !has {
+        rooms = make(map[string]bool)
+        h.conns[conn] = rooms
+    }
+    rooms[room] = true
+
+    members, has := h.rooms[room]
+    if !has {
+        members = make(map[*ws.Conn]bool)
+        h.rooms[room] = members
+    }
+    members[conn] = true
+}
+
+func (h *Hub) Leave(room string, conn *ws.Conn) {
+    h.locker.Lock()
+    defer h.locker.Unlock()
+
+    h.leave(room, conn)
+}
+
+func (h *Hub) leave(room string, conn *ws.Conn) {
+    delete(h.conns[conn], room)
+    if members, has := h.rooms[room]; has {
+        delete(members, conn)
+
+        //empty rooms are dropped
+        if len(members) == 0 {
+            delete(h.rooms, room)
+        }
+    }
+}
+
+/**
+ * SetPresence attaches v to the connection
+ * such as the user name, it is listed by Presence
+ */
+func (h *Hub) SetPresence(conn *ws.Conn, v interface{}) {
+    h.locker.Lock()
+    h.presence[conn] = v
+    h.locker.Unlock()
+}
+
+/**
+ * Presence returns the presence values of connections in the room
+ * connections without one are not included
+ */
+func (h *Hub) Presence(room string) []interface{} {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    list := make([]interface{}, 0, len(h.rooms[room]))
+    for conn := range h.rooms[room] {
+        if v, has := h.presence[conn]; has {
+            list = append(list, v)
+        }
+    }
+
+    return list
+}
+
+func (h *Hub) Members(room string) []*ws.Conn {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    return connList(h.rooms[room])
+}
+
+func (h *Hub) Count(room string) int {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    return len(h.rooms[room])
+}
+
+func (h *Hub) Rooms(conn *ws.Conn) []string {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    rooms := make([]string, 0, len(h.conns[conn]))
+    for room := range h.conns[conn] {
+        rooms = append(rooms, room)
+    }
+
+    return rooms
+}
+
+func (h *Hub) Len() int {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    return len(h.conns)
+}
+
+/**
+ * Broadcast sends txt to every connection in the room
+ * and returns how many connections it is sent to
+ */
+func (h *Hub) Broadcast(room, txt string) int {
+    h.locker.RLock()
+    conns := connList(h.rooms[room])
+    h.locker.RUnlock()
+
+    return h.send(conns, ws.TextMessage, []byte(txt))
+}
+
+func (h *Hub) BroadcastJson(room string, v interface{}) int {
+    data, e := json.Marshal(v)
+    if e != nil {
+        L.Error("could not encode json", "error", e)
+        return 0
+    }
+
+    h.locker.RLock()
+    conns := connList(h.rooms[room])
+    h.locker.RUnlock()
+
+    return h.send(conns, ws.TextMessage, data)
+}
+
+/**
+ * BroadcastAll sends txt to all connections in the hub
+ */
+func (h *Hub) BroadcastAll(txt string) int {
+    return h.send(h.all(), ws.TextMessage, []byte(txt))
+}
+
+func (h *Hub) BroadcastAllJson(v interface{}) int {
+    data, e := json.Marshal(v)
+    if e != nil {
+        L.Error("could not encode json", "error", e)
+        return 0
+    }
+
+    return h.send(h.all(), ws.TextMessage, data)
+}
+
+func (h *Hub) all() []*ws.Conn {
+    h.locker.RLock()
+    defer h.locker.RUnlock()
+
+    conns := make([]*ws.Conn, 0, len(h.conns))
+    for conn := range h.conns {
+        conns = append(conns, conn)
+    }
+
+    return conns
+}
+
+/**
+ * send queues data outside the lock, so a slow connection
+ * never blocks joining, leaving or other connections
+ * closed connections are removed, full queues are skipped
+ */
+func (h *Hub) send(conns []*ws.Conn, typ int, data []byte) int {
+    n := 0
+    for _, conn := range conns {
+        e := conn.Send(typ, data)
+        if e == nil {
+            n++
+            continue
+        }
+
+        L.Debug("websocket broadcast failed", "remote", conn.RemoteAddr().String(), "error", e)
+        if e != ws.ErrQueueFull {
+            h.Remove(conn)
+            conn.Close()
+        }
+    }
+
+    return n
+}
+
+func connList(m map[*ws.Conn]bool) []*ws.Conn {
+    list := make([]*ws.Conn, 0, len(m))
+    for conn := range m {
+        list = append(list, conn)
+    }
+
+    return list
+}
@@ -0,0 +1,217 @@
+package potato
+
+import (
+    "bufio"
+    ws "github.com/roydong/potato/websocket"
+    "io"
+    "net"
+    "net/http/httptest"
+    "sort"
+    "testing"
+    "time"
+)
+
+type pipeHijacker struct {
+    *httptest.ResponseRecorder
+    conn net.Conn
+}
+
+func (h *pipeHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    return h.conn, bufio.NewReadWriter(bufio.NewReader(h.conn), bufio.NewWriter(h.conn)), nil
+}
+
+/**
+ * hubConn upgrades one end of a pipe with a send queue of size
+ * the other end is returned for reading what the hub sends
+ */
+func hubConn(t *testing.T, size int) (*ws.Conn, net.Conn) {
+    server, client := net.Pipe()
+    t.Cleanup(func() {
+        client.Close()
+        server.Close()
+    })
+
+    r := httptest.NewRequest("GET", "/", nil)
+    r.Header.Set("Upgrade", "websocket")
+    r.Header.Set("Connection", "Upgrade")
+    r.Header.Set("Sec-WebSocket-Version", "13")
+    r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+    //the 101 response is read byte by byte so no frame is buffered away
+    done := make(chan bool)
+    go func() {
+        defer close(done)
+        end := []byte("\r\n\r\n")
+        var head []byte
+        b := make([]byte, 1)
+        for len(head) < 4 || string(head[len(head)-4:]) != string(end) {
+            if _, e := client.Read(b); e != nil {
+                return
+            }
+            head = append(head, b[0])
+        }
+    }()
+
+    c, e := ws.Upgrade(&pipeHijacker{httptest.NewRecorder(), server}, r, nil)
+    if e != nil {
+        t.Fatal(e)
+    }
+    <-done
+
+    c.StartQueue(size, ws.QueueDrop)
+    return c, client
+}
+
+/**
+ * readText reads one unmasked text frame sent by the server
+ */
+func readText(t *testing.T, client net.Conn) string {
+    client.SetReadDeadline(time.Now().Add(time.Second))
+    head := make([]byte, 2)
+    if _, e := io.ReadFull(client, head); e != nil {
+        t.Fatal(e)
+    }
+
+    if head[0]&0x0f != ws.TextMessage {
+        t.Fatalf("got opcode %d", head[0]&0x0f)
+    }
+
+    data := make([]byte, head[1]&0x7f)
+    if _, e := io.ReadFull(client, data); e != nil {
+        t.Fatal(e)
+    }
+
+    return string(data)
+}
+
+func TestHubRooms(t *testing.T) {
+    h := NewHub()
+    a, b := new(ws.Conn), new(ws.Conn)
+
+    h.Add(a)
+    h.Join("lobby", a)
+    h.Join("game", a)
+    h.Join("lobby", b)
+    if h.Len() != 2 || h.Count("lobby") != 2 || h.Count("game") != 1 {
+        t.Fatalf("got %d conns, %d in lobby, %d in game", h.Len(), h.Count("lobby"), h.Count("game"))
+    }
+
+    rooms := h.Rooms(a)
+    sort.Strings(rooms)
+    if len(rooms) != 2 || rooms[0] != "game" || rooms[1] != "lobby" {
+        t.Fatalf("got rooms %v", rooms)
+    }
+
+    h.Leave("game", a)
+    if h.Count("game") != 0 || len(h.Rooms(a)) != 1 {
+        t.Fatal("leave kept the room")
+    }
+    if _, has := h.rooms["game"]; has {
+        t.Fatal("empty room kept")
+    }
+
+    h.SetPresence(a, "alice")
+    h.Remove(a)
+    if h.Len() != 1 || h.Count("lobby") != 1 || len(h.Rooms(a)) != 0 {
+        t.Fatal("remove kept the connection")
+    }
+    if _, has := h.presence[a]; has {
+        t.Fatal("remove kept the presence")
+    }
+
+    h.Remove(b)
+    if len(h.rooms) != 0 || len(h.conns) != 0 {
+        t.Fatalf("left %v rooms %v conns", h.rooms, h.conns)
+    }
+}
+
+func TestHubPresence(t *testing.T) {
+    h := NewHub()
+    a, b, c := new(ws.Conn), new(ws.Conn), new(ws.Conn)
+    h.Join("lobby", a)
+    h.Join("lobby", b)
+    h.Join("game", c)
+    h.SetPresence(a, "alice")
+    h.SetPresence(c, "carol")
+
+    if got := h.Presence("lobby"); len(got) != 1 || got[0] != "alice" {
+        t.Fatalf("got %v", got)
+    }
+    if got := h.Members("lobby"); len(got) != 2 {
+        t.Fatalf("got %d members", len(got))
+    }
+}
+
+func TestHubBroadcast(t *testing.T) {
+    h := NewHub()
+    a, ca := hubConn(t, 8)
+    b, cb := hubConn(t, 8)
+    h.Join("lobby", a)
+    h.Add(b)
+
+    if n := h.Broadcast("lobby", "hi"); n != 1 {
+        t.Fatalf("sent to %d", n)
+    }
+    if got := readText(t, ca); got != "hi" {
+        t.Fatalf("got %q", got)
+    }
+
+    if n := h.BroadcastJson("lobby", map[string]int{"n": 1}); n != 1 || readText(t, ca) != `{"n":1}` {
+        t.Fatalf("json sent to %d", n)
+    }
+
+    if n := h.BroadcastAllJson([]int{1, 2}); n != 2 {
+        t.Fatalf("sent to %d", n)
+    }
+    for _, client := range []net.Conn{ca, cb} {
+        if got := readText(t, client); got != "[1,2]" {
+            t.Fatalf("got %q", got)
+        }
+    }
+
+    if n := h.BroadcastAll("bye"); n != 2 || readText(t, ca) != "bye" || readText(t, cb) != "bye" {
+        t.Fatalf("sent to %d", n)
+    }
+
+    if n := h.BroadcastAllJson(func() {}); n != 0 {
+        t.Fatal("sent json that can not be encoded")
+    }
+}
+
+func TestHubBroadcastSkipsFullQueue(t *testing.T) {
+    h := NewHub()
+    slow, _ := hubConn(t, 1)
+    fast, client := hubConn(t, 8)
+    h.Join("lobby", slow)
+    h.Join("lobby", fast)
+
+    //nothing reads the slow peer, so its queue fills up
+    for slow.Send(ws.TextMessage, []byte("x")) != ws.ErrQueueFull {
+    }
+
+    if n := h.Broadcast("lobby", "hi"); n != 1 {
+        t.Fatalf("sent to %d", n)
+    }
+    if got := readText(t, client); got != "hi" {
+        t.Fatalf("got %q", got)
+    }
+    if h.Count("lobby") != 2 {
+        t.Fatal("slow connection removed")
+    }
+}
+
+func TestHubBroadcastRemovesClosed(t *testing.T) {
+    h := NewHub()
+    c, client := hubConn(t, 8)
+    h.Join("lobby", c)
+    h.SetPresence(c, "alice")
+
+    client.Close()
+    c.Close()
+    if n := h.Broadcast("lobby", "hi"); n != 0 {
+        t.Fatalf("sent to %d", n)
+    }
+    if h.Len() != 0 || h.Count("lobby") != 0 || len(h.Presence("lobby")) != 0 {
+        t.Fatal("closed connection kept")
+    }
+}
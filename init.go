@@ -2,9 +2,14 @@ package potato
 
 import (
     "github.com/roydong/potato/orm"
+    ws "github.com/roydong/potato/websocket"
+    "io"
     "log"
+    "log/slog"
+    "net/http"
     "os"
     "strings"
+    "time"
 )
 
 var (
@@ -23,7 +28,7 @@ var (
     }
 
     C   *Tree
-    L   *log.Logger
+    L   *slog.Logger
     R   *Router
     T   *Template
 )
@@ -56,6 +61,8 @@ func Init() {
         SessionCookieName = v
     }
 
+    initSessionCookie()
+
     if v, ok := C.String("error_route_name"); ok {
         ErrorRouteName = v
     }
@@ -76,20 +83,88 @@ func Init() {
         Dir.Log = dir + "/"
     }
 
-    //logger
-    var logio *os.File
-    if Env == "dev" {
-        logio = os.Stdout
-    } else {
-        var e error
-        logio, e = os.OpenFile(Dir.Log+Env+".log",
-            os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-        if e != nil {
-            log.Fatal("Error init log file:", e)
-        }
+    if v, ok := C.String("log_level"); ok {
+        LogLevel = v
+    }
+
+    if v, ok := C.String("log_format"); ok {
+        LogFormat = v
+    }
+
+    //log_max_size is in megabytes
+    if v, ok := C.Int("log_max_size"); ok {
+        LogMaxSize = int64(v) * 1024 * 1024
+    }
+
+    if v, ok := C.Bool("log_rotate_daily"); ok {
+        LogRotateDaily = v
     }
 
-    L = log.New(logio, "", log.LstdFlags)
+    if v, ok := C.Int("log_max_backups"); ok {
+        LogMaxBackups = v
+    }
+
+    if v, ok := C.Bool("log_compress"); ok {
+        LogCompress = v
+    }
+
+    if v, ok := C.String("access_log"); ok {
+        AccessLogFormat = v
+    }
+
+    if v, ok := C.String("metrics_path"); ok {
+        MetricsPath = v
+    }
+
+    if v, ok := C.String("auth_login_url"); ok {
+        AuthLoginUrl = v
+    }
+
+    TokenKeys = configStrings("token_keys")
+
+    if v, ok := C.Bool("csrf"); ok {
+        CSRFEnabled = v
+    }
+
+    //in bytes
+    if v, ok := C.Int("max_upload_size"); ok {
+        MaxUploadSize = int64(v)
+    }
+
+    if v, ok := C.Int("max_json_size"); ok {
+        MaxJsonSize = int64(v)
+    }
+
+    if v, ok := C.String("upload_dir"); ok {
+        UploadStorage = NewDiskStorage(v)
+    }
+
+    if v, ok := C.Int("sse_heartbeat"); ok {
+        SSEHeartbeat = time.Duration(v) * time.Second
+    }
+
+    if v, ok := C.String("health_path"); ok {
+        HealthPath = v
+    }
+
+    if v, ok := C.String("ready_path"); ok {
+        ReadyPath = v
+    }
+
+    //in seconds
+    if v, ok := C.Int("shutdown_delay"); ok {
+        ShutdownDelay = time.Duration(v) * time.Second
+    }
+
+    if v, ok := C.Int("shutdown_timeout"); ok {
+        ShutdownTimeout = time.Duration(v) * time.Second
+    }
+
+    //logger
+    L = NewLogger(logWriter(Dir.Log+Env+".log"), LogLevel, LogFormat)
+    if AccessLogFormat != AccessLogOff {
+        AccessLog = logWriter(Dir.Log + Env + ".access.log")
+    }
 
     //router
     R = NewRouter()
@@ -99,9 +174,147 @@ func Init() {
     T = NewTemplate(Dir.Template)
 
     initOrm()
+    initWebSocket()
+    initSession()
     go sessionExpire()
 }
 
+/**
+ * logWriter returns stdout in dev env
+ * otherwise a rotated log file with the configured policy
+ */
+func logWriter(filename string) io.Writer {
+    if Env == "dev" {
+        return os.Stdout
+    }
+
+    f, e := NewLogFile(filename)
+    if e != nil {
+        log.Fatal("Error init log file:", e)
+    }
+
+    f.MaxSize = LogMaxSize
+    f.Daily = LogRotateDaily
+    f.MaxBackups = LogMaxBackups
+    f.Compress = LogCompress
+    f.ReopenOnSignal()
+    return f
+}
+
+/**
+ * initWebSocket reads the websocket tree in config
+ * durations are in seconds, max_message_size in bytes
+ * zero max_message_size is websocket.DefaultMaxMessageSize
+ * queue_policy is drop or disconnect
+ */
+func initWebSocket() {
+    if c, ok := C.Tree("websocket"); ok {
+        if v, ok := c.Int("ping_interval"); ok {
+            WSPingInterval = time.Duration(v) * time.Second
+        }
+        if v, ok := c.Int("read_timeout"); ok {
+            WSReadTimeout = time.Duration(v) * time.Second
+        }
+        if v, ok := c.Int("write_timeout"); ok {
+            WSWriteTimeout = time.Duration(v) * time.Second
+        }
+        if v, ok := c.Int("max_message_size"); ok {
+            WSMaxMessageSize = int64(v)
+        }
+        if v, ok := c.Int("send_queue"); ok {
+            WSSendQueue = v
+        }
+        if v, ok := c.String("queue_policy"); ok && v == "disconnect" {
+            WSQueuePolicy = ws.QueueDisconnect
+        }
+    }
+}
+
+/**
+ * initSessionCookie reads the cookie attributes and lifetimes
+ * of sessions, lifetimes are in seconds
+ */
+func initSessionCookie() {
+    if v, ok := C.String("session_domain"); ok {
+        SessionDomain = v
+    }
+    if v, ok := C.String("session_path"); ok {
+        SessionPath = v
+    }
+    if v, ok := C.Bool("session_secure"); ok {
+        SessionSecure = v
+    }
+    if v, ok := C.Bool("session_http_only"); ok {
+        SessionHttpOnly = v
+    }
+    if v, ok := C.String("session_same_site"); ok {
+        switch strings.ToLower(v) {
+        case "strict":
+            SessionSameSite = http.SameSiteStrictMode
+        case "none":
+            SessionSameSite = http.SameSiteNoneMode
+        case "lax":
+            SessionSameSite = http.SameSiteLaxMode
+        default:
+            SessionSameSite = http.SameSiteDefaultMode
+        }
+    }
+    if v, ok := C.Int("session_max_age"); ok {
+        SessionMaxAge = v
+    }
+    if v, ok := C.Int("session_duration"); ok {
+        SessionDuration = int64(v)
+    }
+    if v, ok := C.Int("session_lifetime"); ok {
+        SessionLifetime = int64(v)
+    }
+    if v, ok := C.Int("session_remember"); ok {
+        SessionRemember = int64(v)
+    }
+    if v, ok := C.Bool("session_sliding"); ok {
+        SessionSliding = v
+    }
+}
+
+func initSession() {
+    name, _ := C.String("session_store")
+    dir, ok := C.String("session_dir")
+    if !ok {
+        dir = "session/"
+    }
+    table, _ := C.String("session_table")
+
+    var store SessionStore
+    var e error
+    if name == "cookie" {
+        encrypt, _ := C.Bool("session_encrypt")
+        store, e = NewCookieStore(configStrings("session_keys"), encrypt)
+    } else {
+        store, e = NewSessionStore(name, dir, table)
+    }
+
+    if e != nil {
+        fatal("could not init session store", "error", e)
+    }
+
+    SessionStorage = store
+}
+
+/**
+ * configStrings reads a list of strings from config
+ */
+func configStrings(path string) []string {
+    list, _ := C.Value(path).([]interface{})
+    strs := make([]string, 0, len(list))
+    for _, v := range list {
+        if s, ok := v.(string); ok {
+            strs = append(strs, s)
+        }
+    }
+
+    return strs
+}
+
 func initOrm() {
     if c, ok := C.Tree("sql"); ok {
         dbc := &orm.Config{
@@ -135,6 +348,10 @@ func initOrm() {
             dbc.MaxConn = v
         }
 
+        orm.QueryHook = M.ObserveQuery
         orm.Init(dbc, L)
+        AddReadyCheck("orm", func() error {
+            return orm.D.Ping()
+        })
     }
 }
@@ -0,0 +1,12 @@
+package potato
+
+import (
+    "io"
+    "os"
+    "testing"
+)
+
+func TestMain(m *testing.M) {
+    L = NewLogger(io.Discard, "error", "text")
+    os.Exit(m.Run())
+}
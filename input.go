@@ -0,0 +1,266 @@
+package potato
+
+import (
+    "net/url"
+    "strconv"
+    "time"
+)
+
+/**
+ * Input reads typed values from one source of the request
+ * the request itself reads route params first then the query and body
+ * Query, Posted, Params and Headers read only their own source
+ * they are not named Form, Body and Header which are fields of http.Request
+ * single values are read from the first one like FormValue does,
+ * an empty value is taken as missing except route params which are set
+ * even if empty, Strings skips empty values, keys like tags[] are found as tags
+ */
+type Input struct {
+    //set tells if empty values are given on purpose
+    lookup func(k string) (vs []string, set bool)
+}
+
+func valuesLookup(values func() url.Values) func(k string) ([]string, bool) {
+    return func(k string) ([]string, bool) {
+        vs := values()
+        if v, has := vs[k]; has {
+            return v, false
+        }
+
+        return vs[k+"[]"], false
+    }
+}
+
+/**
+ * Query reads only the query string
+ */
+func (r *Request) Query() *Input {
+    return &Input{valuesLookup(r.URL.Query)}
+}
+
+/**
+ * Posted reads only urlencoded or multipart bodies
+ */
+func (r *Request) Posted() *Input {
+    return &Input{valuesLookup(func() url.Values {
+        r.parseForm()
+        return r.PostForm
+    })}
+}
+
+/**
+ * Params reads only the params from the route pattern
+ */
+func (r *Request) Params() *Input {
+    return &Input{func(k string) ([]string, bool) {
+        if v, has := r.params[k]; has {
+            return []string{v}, true
+        }
+
+        return nil, false
+    }}
+}
+
+/**
+ * Headers reads request headers, keys are case insensitive
+ */
+func (r *Request) Headers() *Input {
+    return &Input{func(k string) ([]string, bool) {
+        return r.Header.Values(k), false
+    }}
+}
+
+/**
+ * lookup of the request, route params win over the query and body
+ */
+func (r *Request) lookup(k string) ([]string, bool) {
+    if v, has := r.params[k]; has {
+        return []string{v}, true
+    }
+
+    r.parseForm()
+    if v, has := r.Form[k]; has {
+        return v, false
+    }
+
+    return r.Form[k+"[]"], false
+}
+
+/**
+ * parseForm parses the query and body once, like FormValue does
+ */
+func (r *Request) parseForm() {
+    if r.Form == nil {
+        r.ParseMultipartForm(MaxMultipartMemory)
+    }
+}
+
+func (in *Input) Strings(k string) ([]string, bool) {
+    vals, set := in.lookup(k)
+    vs := make([]string, 0, len(vals))
+    for _, v := range vals {
+        if len(v) > 0 || set {
+            vs = append(vs, v)
+        }
+    }
+
+    return vs, len(vs) > 0
+}
+
+func (in *Input) String(k string) (string, bool) {
+    vs, set := in.lookup(k)
+    if len(vs) == 0 {
+        return "", false
+    }
+
+    return vs[0], len(vs[0]) > 0 || set
+}
+
+func (in *Input) Int(k string) (int, bool) {
+    if v, has := in.String(k); has {
+        if i, e := strconv.ParseInt(v, 10, 0); e == nil {
+            return int(i), true
+        }
+    }
+
+    return 0, false
+}
+
+func (in *Input) Int64(k string) (int64, bool) {
+    if v, has := in.String(k); has {
+        if i, e := strconv.ParseInt(v, 10, 64); e == nil {
+            return i, true
+        }
+    }
+
+    return 0, false
+}
+
+func (in *Input) Float(k string) (float64, bool) {
+    if v, has := in.String(k); has {
+        if f, e := strconv.ParseFloat(v, 64); e == nil {
+            return f, true
+        }
+    }
+
+    return 0, false
+}
+
+/**
+ * Bool accepts what strconv does plus on/off and yes/no
+ */
+func (in *Input) Bool(k string) (bool, bool) {
+    if v, has := in.String(k); has {
+        if b, e := parseBool(v); e == nil {
+            return b, true
+        }
+    }
+
+    return false, false
+}
+
+/**
+ * Ints fails if any of the values is not an integer
+ */
+func (in *Input) Ints(k string) ([]int, bool) {
+    vs, has := in.Strings(k)
+    if !has {
+        return nil, false
+    }
+
+    ints := make([]int, 0, len(vs))
+    for _, v := range vs {
+        i, e := strconv.ParseInt(v, 10, 0)
+        if e != nil {
+            return nil, false
+        }
+        ints = append(ints, int(i))
+    }
+
+    return ints, true
+}
+
+/**
+ * Time parses the value by layout, or by TimeLayouts if layout is empty
+ */
+func (in *Input) Time(k, layout string) (time.Time, bool) {
+    if v, has := in.String(k); has {
+        if t, e := parseTime(v, layout); e == nil {
+            return t, true
+        }
+    }
+
+    return time.Time{}, false
+}
+
+/**
+ * Duration parses values like 1h30m
+ */
+func (in *Input) Duration(k string) (time.Duration, bool) {
+    if v, has := in.String(k); has {
+        if d, e := time.ParseDuration(v); e == nil {
+            return d, true
+        }
+    }
+
+    return 0, false
+}
+
+/**
+ * the Default variants return d if the value is missing or invalid
+ */
+func (in *Input) StringDefault(k, d string) string {
+    if v, has := in.String(k); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) IntDefault(k string, d int) int {
+    if v, has := in.Int(k); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) Int64Default(k string, d int64) int64 {
+    if v, has := in.Int64(k); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) FloatDefault(k string, d float64) float64 {
+    if v, has := in.Float(k); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) BoolDefault(k string, d bool) bool {
+    if v, has := in.Bool(k); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) TimeDefault(k, layout string, d time.Time) time.Time {
+    if v, has := in.Time(k, layout); has {
+        return v
+    }
+
+    return d
+}
+
+func (in *Input) DurationDefault(k string, d time.Duration) time.Duration {
+    if v, has := in.Duration(k); has {
+        return v
+    }
+
+    return d
+}
@@ -0,0 +1,127 @@
+package potato
+
+import (
+    "net/url"
+    "testing"
+    "time"
+)
+
+func TestInputString(t *testing.T) {
+    r := formRequest("a=&a=5&b=x&c=q", url.Values{"c": {"body"}, "d": {""}}, map[string]string{"id": "", "b": "param"})
+
+    tests := []struct {
+        k   string
+        v   string
+        has bool
+    }{
+        {"a", "", false},
+        {"b", "param", true},
+        {"c", "body", true},
+        {"d", "", false},
+        {"id", "", true},
+        {"none", "", false},
+    }
+
+    for _, test := range tests {
+        if v, has := r.String(test.k); v != test.v || has != test.has {
+            t.Errorf("%s got %q %v, want %q %v", test.k, v, has, test.v, test.has)
+        }
+    }
+
+    if _, has := r.Int("a"); has {
+        t.Error("int of an empty first value found")
+    }
+    if _, has := r.Int("id"); has {
+        t.Error("int of an empty param found")
+    }
+}
+
+func TestInputTyped(t *testing.T) {
+    r := formRequest("i=42&big=9000000000&f=1.5&b=yes&bad=x&t=2020-01-02&d=1h30m&ids=1&ids=2&tags[]=a&tags[]=&tags[]=b", nil, nil)
+
+    if v, has := r.Int("i"); v != 42 || !has {
+        t.Errorf("Int got %d %v", v, has)
+    }
+    if v, has := r.Int64("big"); v != 9000000000 || !has {
+        t.Errorf("Int64 got %d %v", v, has)
+    }
+    if v, has := r.Float("f"); v != 1.5 || !has {
+        t.Errorf("Float got %v %v", v, has)
+    }
+    if v, has := r.Bool("b"); !v || !has {
+        t.Errorf("Bool got %v %v", v, has)
+    }
+    if v, has := r.Time("t", ""); !has || v.Day() != 2 {
+        t.Errorf("Time got %v %v", v, has)
+    }
+    if v, has := r.Duration("d"); v != 90*time.Minute || !has {
+        t.Errorf("Duration got %v %v", v, has)
+    }
+    if v, has := r.Ints("ids"); !has || len(v) != 2 || v[1] != 2 {
+        t.Errorf("Ints got %v %v", v, has)
+    }
+    if v, has := r.Strings("tags"); !has || len(v) != 2 || v[1] != "b" {
+        t.Errorf("Strings got %v %v", v, has)
+    }
+
+    for _, k := range []string{"bad", "none"} {
+        if _, has := r.Int(k); has {
+            t.Errorf("Int %s found", k)
+        }
+        if _, has := r.Bool(k); has {
+            t.Errorf("Bool %s found", k)
+        }
+        if _, has := r.Ints(k); has {
+            t.Errorf("Ints %s found", k)
+        }
+    }
+}
+
+func TestInputDefaults(t *testing.T) {
+    r := formRequest("page=2&bad=x", nil, nil)
+
+    if v := r.IntDefault("page", 1); v != 2 {
+        t.Errorf("IntDefault got %d", v)
+    }
+    if v := r.IntDefault("bad", 1); v != 1 {
+        t.Errorf("IntDefault of invalid got %d", v)
+    }
+    if v := r.StringDefault("none", "d"); v != "d" {
+        t.Errorf("StringDefault got %q", v)
+    }
+    if v := r.DurationDefault("bad", time.Second); v != time.Second {
+        t.Errorf("DurationDefault got %v", v)
+    }
+    if v := r.BoolDefault("none", true); !v {
+        t.Error("BoolDefault got false")
+    }
+}
+
+func TestInputSources(t *testing.T) {
+    r := formRequest("k=query", url.Values{"k": {"body"}}, map[string]string{"k": "param"})
+    r.Header.Set("X-Page", "7")
+
+    tests := []struct {
+        name string
+        in   *Input
+        v    string
+    }{
+        {"request", &r.Input, "param"},
+        {"query", r.Query(), "query"},
+        {"posted", r.Posted(), "body"},
+        {"params", r.Params(), "param"},
+    }
+
+    for _, test := range tests {
+        if v, _ := test.in.String("k"); v != test.v {
+            t.Errorf("%s got %q, want %q", test.name, v, test.v)
+        }
+    }
+
+    if v, has := r.Headers().Int("x-page"); v != 7 || !has {
+        t.Errorf("header got %d %v", v, has)
+    }
+    if _, has := r.Query().String("x-page"); has {
+        t.Error("query read a header")
+    }
+}
@@ -0,0 +1,53 @@
+package potato
+
+import (
+    "io"
+    "log/slog"
+    "os"
+    "strings"
+)
+
+var (
+    LogLevel  = "info"
+    LogFormat = "text"
+)
+
+/**
+ * NewLogger creates a leveled structured logger writes to w
+ * level is one of debug, info, warn and error
+ * format is either text or json
+ */
+func NewLogger(w io.Writer, level, format string) *slog.Logger {
+    opts := &slog.HandlerOptions{Level: logLevel(level)}
+
+    var h slog.Handler
+    if strings.ToLower(format) == "json" {
+        h = slog.NewJSONHandler(w, opts)
+    } else {
+        h = slog.NewTextHandler(w, opts)
+    }
+
+    return slog.New(h)
+}
+
+func logLevel(level string) slog.Level {
+    switch strings.ToLower(level) {
+    case "debug":
+        return slog.LevelDebug
+    case "warn", "warning":
+        return slog.LevelWarn
+    case "error":
+        return slog.LevelError
+    }
+
+    return slog.LevelInfo
+}
+
+/**
+ * fatal logs the message at error level then exits
+ * it replaces the Fatal method of the old log.Logger
+ */
+func fatal(msg string, args ...interface{}) {
+    L.Error(msg, args...)
+    os.Exit(1)
+}
@@ -0,0 +1,227 @@
+package potato
+
+import (
+    "compress/gzip"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "sync"
+    "time"
+)
+
+const (
+    logFileTimeFormat = "20060102T150405.000"
+)
+
+var (
+    LogMaxSize     = int64(0)
+    LogRotateDaily = false
+    LogMaxBackups  = 0
+    LogCompress    = false
+)
+
+/**
+ * LogFile is an io.Writer writes to Filename and rotates it
+ * when it grows bigger than MaxSize bytes or the day changes.
+ * rotated files are renamed with a timestamp suffix, gzipped if
+ * Compress is set and only the newest MaxBackups of them are kept
+ * zero values of MaxSize and MaxBackups mean no limit
+ */
+type LogFile struct {
+    Filename   string
+    MaxSize    int64
+    Daily      bool
+    MaxBackups int
+    Compress   bool
+
+    file    *os.File
+    size    int64
+    day     int
+    locker  sync.Mutex
+    cleaner sync.Mutex
+}
+
+func NewLogFile(filename string) (*LogFile, error) {
+    f := &LogFile{Filename: filename}
+    if e := f.open(); e != nil {
+        return nil, e
+    }
+
+    return f, nil
+}
+
+func (f *LogFile) Write(p []byte) (int, error) {
+    f.locker.Lock()
+    defer f.locker.Unlock()
+
+    if f.file == nil {
+        if e := f.open(); e != nil {
+            return 0, e
+        }
+    }
+
+    if f.needRotate(int64(len(p))) {
+        if e := f.rotate(); e != nil {
+            return 0, e
+        }
+    }
+
+    n, e := f.file.Write(p)
+    f.size += int64(n)
+    return n, e
+}
+
+/**
+ * Reopen closes and opens the log file again
+ * used after the file is moved away by an external tool like logrotate
+ */
+func (f *LogFile) Reopen() error {
+    f.locker.Lock()
+    defer f.locker.Unlock()
+
+    f.close()
+    return f.open()
+}
+
+/**
+ * Rotate rotates the log file immediately
+ */
+func (f *LogFile) Rotate() error {
+    f.locker.Lock()
+    defer f.locker.Unlock()
+
+    return f.rotate()
+}
+
+func (f *LogFile) Close() error {
+    f.locker.Lock()
+    defer f.locker.Unlock()
+
+    return f.close()
+}
+
+func (f *LogFile) open() error {
+    file, e := os.OpenFile(f.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+    if e != nil {
+        return e
+    }
+
+    info, e := file.Stat()
+    if e != nil {
+        file.Close()
+        return e
+    }
+
+    f.file = file
+    f.size = info.Size()
+
+    //an existing file belongs to the day it was last written
+    f.day = yearDay(time.Now())
+    if f.size > 0 {
+        f.day = yearDay(info.ModTime())
+    }
+
+    return nil
+}
+
+func (f *LogFile) close() error {
+    if f.file == nil {
+        return nil
+    }
+
+    e := f.file.Close()
+    f.file = nil
+    return e
+}
+
+func (f *LogFile) needRotate(n int64) bool {
+    if f.MaxSize > 0 && f.size > 0 && f.size+n > f.MaxSize {
+        return true
+    }
+
+    return f.Daily && f.day != yearDay(time.Now())
+}
+
+func (f *LogFile) rotate() error {
+    if e := f.close(); e != nil {
+        return e
+    }
+
+    backup := f.Filename + "." + time.Now().Format(logFileTimeFormat)
+    if e := os.Rename(f.Filename, backup); e != nil && !os.IsNotExist(e) {
+        return e
+    }
+
+    if e := f.open(); e != nil {
+        return e
+    }
+
+    go f.clean(backup)
+    return nil
+}
+
+/**
+ * clean compresses the newly rotated file
+ * and removes the old ones exceed MaxBackups
+ */
+func (f *LogFile) clean(backup string) {
+    f.cleaner.Lock()
+    defer f.cleaner.Unlock()
+
+    if f.Compress {
+        if e := gzipFile(backup); e != nil {
+            L.Error("could not compress log file", "file", backup, "error", e)
+        }
+    }
+
+    if f.MaxBackups <= 0 {
+        return
+    }
+
+    //backup names end with sortable timestamps
+    backups, e := filepath.Glob(f.Filename + ".*")
+    if e != nil {
+        return
+    }
+
+    sort.Strings(backups)
+    for i := 0; i < len(backups)-f.MaxBackups; i++ {
+        if e := os.Remove(backups[i]); e != nil {
+            L.Error("could not remove log file", "file", backups[i], "error", e)
+        }
+    }
+}
+
+func gzipFile(name string) error {
+    src, e := os.Open(name)
+    if e != nil {
+        return e
+    }
+    defer src.Close()
+
+    dst, e := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+    if e != nil {
+        return e
+    }
+
+    gz := gzip.NewWriter(dst)
+    if _, e = io.Copy(gz, src); e == nil {
+        e = gz.Close()
+    }
+
+    if e2 := dst.Close(); e == nil {
+        e = e2
+    }
+
+    if e != nil {
+        os.Remove(name + ".gz")
+        return e
+    }
+
+    return os.Remove(name)
+}
+
+func yearDay(t time.Time) int {
+    return t.Year()*1000 + t.YearDay()
+}
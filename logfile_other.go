@@ -0,0 +1,10 @@
+//go:build !unix
+
+package potato
+
+/**
+ * ReopenOnSignal does nothing where there is no SIGUSR1
+ * the log file can still be reopened by calling Reopen
+ */
+func (f *LogFile) ReopenOnSignal() {
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package potato
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+)
+
+/**
+ * ReopenOnSignal reopens the log file every time
+ * the process receives SIGUSR1
+ */
+func (f *LogFile) ReopenOnSignal() {
+    ch := make(chan os.Signal, 1)
+    signal.Notify(ch, syscall.SIGUSR1)
+    go func() {
+        for range ch {
+            if e := f.Reopen(); e != nil {
+                L.Error("could not reopen log file", "file", f.Filename, "error", e)
+            } else {
+                L.Info("log file reopened", "file", f.Filename)
+            }
+        }
+    }()
+}
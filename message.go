@@ -0,0 +1,142 @@
+package potato
+
+import (
+    "encoding/json"
+    "fmt"
+    ws "github.com/roydong/potato/websocket"
+    "reflect"
+    "regexp"
+    "strings"
+)
+
+var (
+    messageActionRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+    messageHandlerType  = reflect.TypeOf(func(*WSMessage) (interface{}, error) { return nil, nil })
+)
+
+/**
+ * WSMessage is a json frame received on a dispatching websocket route
+ * like {"id":"1","action":"join","data":{"room":"lobby"}}
+ * Id is optional and echoed in the reply for correlation
+ */
+type WSMessage struct {
+    Id     string          `json:"id,omitempty"`
+    Action string          `json:"action"`
+    Data   json.RawMessage `json:"data,omitempty"`
+}
+
+/**
+ * Bind decodes Data into v
+ */
+func (m *WSMessage) Bind(v interface{}) error {
+    if len(m.Data) == 0 {
+        return nil
+    }
+
+    return json.Unmarshal(m.Data, v)
+}
+
+/**
+ * WSReply is sent back for every message, and used by WSPush
+ * for messages the server sends on its own, which have no Id
+ */
+type WSReply struct {
+    Id     string      `json:"id,omitempty"`
+    Action string      `json:"action,omitempty"`
+    Data   interface{} `json:"data,omitempty"`
+    Error  string      `json:"error,omitempty"`
+}
+
+/**
+ * WSPush sends a message to the current connection without a request
+ */
+func (c *Controller) WSPush(action string, v interface{}) error {
+    return c.WSSendJson(&WSReply{Action: action, Data: v})
+}
+
+/**
+ * serveMessages reads json messages until the connection closes
+ * and calls the controller method named by action with the first letter
+ * upper cased, only methods like
+ *
+ *     func (c *ChatController) Join(m *potato.WSMessage) (interface{}, error)
+ *
+ * can be called, the returned value or error is replied with the message id
+ */
+func (rt *Router) serveMessages(route *Route, c reflect.Value, r *Request) {
+    conn := r.WSConn
+    for {
+        _, data, e := conn.ReadMessage()
+        if e != nil {
+            L.Debug("websocket dispatch ended", "route", route.Name, "error", e)
+            return
+        }
+
+        m := &WSMessage{}
+        if e := json.Unmarshal(data, m); e != nil {
+            rt.reply(r, &WSReply{Error: "invalid message"})
+            continue
+        }
+
+        reply, terminate := rt.callMessage(route, c, r, m)
+        if terminate {
+            return
+        }
+
+        rt.reply(r, reply)
+    }
+}
+
+func (rt *Router) callMessage(route *Route, c reflect.Value, r *Request, m *WSMessage) (reply *WSReply, terminate bool) {
+    reply = &WSReply{Id: m.Id, Action: m.Action}
+    if !messageActionRegexp.MatchString(m.Action) {
+        reply.Error = "unknown action"
+        return reply, false
+    }
+
+    name := strings.ToUpper(m.Action[:1]) + m.Action[1:]
+    method := c.MethodByName(name)
+    if !method.IsValid() || method.Type() != messageHandlerType {
+        reply.Error = "unknown action"
+        return reply, false
+    }
+
+    defer func() {
+        if e := recover(); e != nil {
+            if code, ok := e.(int); ok && code == CodeTerminate {
+                terminate = true
+                return
+            }
+
+            M.ObservePanic()
+            L.Error("panic recovered", "route", route.Name,
+                "action", m.Action, "error", e)
+            reply.Data = nil
+            reply.Error = "internal error"
+        }
+    }()
+
+    rt.TriggerEvent("message_start", c, r, m)
+    out := method.Call([]reflect.Value{reflect.ValueOf(m)})
+    rt.TriggerEvent("message_end", c, r, m)
+
+    reply.Data = out[0].Interface()
+    if e, ok := out[1].Interface().(error); ok && e != nil {
+        reply.Data = nil
+        reply.Error = e.Error()
+    }
+
+    return reply, false
+}
+
+func (rt *Router) reply(r *Request, reply *WSReply) {
+    data, e := json.Marshal(reply)
+    if e != nil {
+        data, _ = json.Marshal(&WSReply{Id: reply.Id, Action: reply.Action,
+            Error: fmt.Sprintf("could not encode reply: %s", e)})
+    }
+
+    if e := r.WSConn.Send(ws.TextMessage, data); e != nil {
+        L.Debug("websocket reply failed", "error", e)
+    }
+}
@@ -0,0 +1,143 @@
+package potato
+
+import (
+    "encoding/json"
+    "errors"
+    ws "github.com/roydong/potato/websocket"
+    "net"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "time"
+)
+
+type chatController struct {
+    Controller
+}
+
+func (c *chatController) Join(m *WSMessage) (interface{}, error) {
+    var d struct {
+        Room string `json:"room"`
+    }
+    if e := m.Bind(&d); e != nil {
+        return nil, e
+    }
+
+    return "joined " + d.Room, nil
+}
+
+func (c *chatController) Refuse(m *WSMessage) (interface{}, error) {
+    return "ignored", errors.New("not allowed")
+}
+
+func (c *chatController) Crash(m *WSMessage) (interface{}, error) {
+    panic("boom")
+}
+
+func (c *chatController) Quit(m *WSMessage) (interface{}, error) {
+    panic(CodeTerminate)
+}
+
+func (c *chatController) Wrong(s string) string {
+    return s
+}
+
+func (c *chatController) Show() {
+}
+
+/**
+ * clientText makes a masked text frame as clients send it
+ */
+func clientText(data string) []byte {
+    mask := []byte{1, 2, 3, 4}
+    frame := append([]byte{0x80 | ws.TextMessage, 0x80 | byte(len(data))}, mask...)
+    for i := 0; i < len(data); i++ {
+        frame = append(frame, data[i]^mask[i%4])
+    }
+
+    return frame
+}
+
+/**
+ * dispatcher serves messages of a chat controller on a pipe
+ * done is closed when serving ends
+ */
+func dispatcher(t *testing.T) (net.Conn, chan bool) {
+    conn, client := hubConn(t, 8)
+    r := NewRequest(httptest.NewRequest("GET", "/chat", nil), nil)
+    r.WSConn = conn
+
+    rt := NewRouter()
+    route := &Route{Name: "chat", Controller: "chat", Dispatch: true}
+    c := NewController(reflect.TypeOf(chatController{}), r, &Response{})
+
+    done := make(chan bool)
+    go func() {
+        defer close(done)
+        rt.serveMessages(route, c, r)
+    }()
+
+    return client, done
+}
+
+func TestDispatchMessages(t *testing.T) {
+    client, done := dispatcher(t)
+
+    tests := []struct {
+        msg   string
+        reply WSReply
+    }{
+        {`{"id":"1","action":"join","data":{"room":"lobby"}}`, WSReply{Id: "1", Action: "join", Data: "joined lobby"}},
+        {`{"action":"join"}`, WSReply{Action: "join", Data: "joined "}},
+        {`{"id":"2","action":"join","data":{"room":5}}`, WSReply{Id: "2", Action: "join"}},
+        {`{"id":"3","action":"refuse"}`, WSReply{Id: "3", Action: "refuse", Error: "not allowed"}},
+        {`{"id":"4","action":"missing"}`, WSReply{Id: "4", Action: "missing", Error: "unknown action"}},
+        {`{"id":"5","action":"wrong"}`, WSReply{Id: "5", Action: "wrong", Error: "unknown action"}},
+        {`{"id":"6","action":"show"}`, WSReply{Id: "6", Action: "show", Error: "unknown action"}},
+        {`{"id":"7","action":"../join"}`, WSReply{Id: "7", Action: "../join", Error: "unknown action"}},
+        {`{"id":"8","action":"crash"}`, WSReply{Id: "8", Action: "crash", Error: "internal error"}},
+        {`not json`, WSReply{Error: "invalid message"}},
+    }
+
+    for _, test := range tests {
+        client.SetWriteDeadline(time.Now().Add(time.Second))
+        if _, e := client.Write(clientText(test.msg)); e != nil {
+            t.Fatal(e)
+        }
+
+        reply := WSReply{}
+        if e := json.Unmarshal([]byte(readText(t, client)), &reply); e != nil {
+            t.Fatal(e)
+        }
+
+        //a bad data field is replied with the decoding error
+        if test.reply.Id == "2" {
+            if len(reply.Error) == 0 || reply.Data != nil {
+                t.Errorf("%s got %+v", test.msg, reply)
+            }
+            continue
+        }
+
+        if reply != test.reply {
+            t.Errorf("%s got %+v, want %+v", test.msg, reply, test.reply)
+        }
+    }
+
+    select {
+    case <-done:
+        t.Fatal("dispatch ended early")
+    default:
+    }
+}
+
+func TestDispatchTerminate(t *testing.T) {
+    client, done := dispatcher(t)
+
+    client.SetWriteDeadline(time.Now().Add(time.Second))
+    client.Write(clientText(`{"id":"1","action":"quit"}`))
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("dispatch not terminated")
+    }
+}
@@ -0,0 +1,211 @@
+package potato
+
+import (
+    "bytes"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    //empty path disables the metrics endpoint
+    MetricsPath = ""
+
+    //latency buckets in seconds
+    MetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+    M = NewMetrics()
+)
+
+type histogram struct {
+    counts []uint64
+    sum    float64
+    count  uint64
+}
+
+func newHistogram() *histogram {
+    return &histogram{counts: make([]uint64, len(MetricsBuckets))}
+}
+
+func (h *histogram) observe(v float64) {
+    for i, b := range MetricsBuckets {
+        if v <= b {
+            h.counts[i]++
+        }
+    }
+    h.sum += v
+    h.count++
+}
+
+/**
+ * Metrics collects request, websocket, session and orm statistics
+ * and exposes them in prometheus text format
+ */
+type Metrics struct {
+    locker      sync.Mutex
+    requests    map[string]map[string]uint64
+    latencies   map[string]*histogram
+    queries     map[string]*histogram
+    queryErrors map[string]uint64
+    panics      uint64
+    wsConns     int64
+}
+
+func NewMetrics() *Metrics {
+    return &Metrics{
+        requests:    make(map[string]map[string]uint64),
+        latencies:   make(map[string]*histogram),
+        queries:     make(map[string]*histogram),
+        queryErrors: make(map[string]uint64),
+    }
+}
+
+func (m *Metrics) ObserveRequest(route string, status int, d time.Duration) {
+    m.locker.Lock()
+    defer m.locker.Unlock()
+
+    route = dash(route)
+    class := fmt.Sprintf("%dxx", status/100)
+    counts, has := m.requests[route]
+    if !has {
+        counts = make(map[string]uint64)
+        m.requests[route] = counts
+    }
+    counts[class]++
+
+    h, has := m.latencies[route]
+    if !has {
+        h = newHistogram()
+        m.latencies[route] = h
+    }
+    h.observe(d.Seconds())
+}
+
+func (m *Metrics) ObserveQuery(action string, d time.Duration, e error) {
+    m.locker.Lock()
+    defer m.locker.Unlock()
+
+    h, has := m.queries[action]
+    if !has {
+        h = newHistogram()
+        m.queries[action] = h
+    }
+    h.observe(d.Seconds())
+
+    if e != nil {
+        m.queryErrors[action]++
+    }
+}
+
+func (m *Metrics) ObservePanic() {
+    m.locker.Lock()
+    m.panics++
+    m.locker.Unlock()
+}
+
+func (m *Metrics) AddWSConn(n int64) {
+    m.locker.Lock()
+    m.wsConns += n
+    m.locker.Unlock()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    w.Write(m.Bytes())
+}
+
+/**
+ * Bytes renders all metrics in prometheus text exposition format
+ */
+func (m *Metrics) Bytes() []byte {
+    sessionCount := SessionCount()
+
+    m.locker.Lock()
+    defer m.locker.Unlock()
+
+    buf := new(bytes.Buffer)
+    buf.WriteString("# HELP potato_requests_total Requests handled by route and status class.\n")
+    buf.WriteString("# TYPE potato_requests_total counter\n")
+    for _, route := range histogramKeys(m.latencies) {
+        counts := m.requests[route]
+        for _, c := range counterKeys(counts) {
+            fmt.Fprintf(buf, "potato_requests_total{route=\"%s\",status=\"%s\"} %d\n",
+                labelValue(route), c, counts[c])
+        }
+    }
+
+    buf.WriteString("# HELP potato_request_duration_seconds Request latency by route.\n")
+    buf.WriteString("# TYPE potato_request_duration_seconds histogram\n")
+    for _, route := range histogramKeys(m.latencies) {
+        writeHistogram(buf, "potato_request_duration_seconds",
+            "route", route, m.latencies[route])
+    }
+
+    buf.WriteString("# HELP potato_panics_total Panics recovered while dispatching.\n")
+    buf.WriteString("# TYPE potato_panics_total counter\n")
+    fmt.Fprintf(buf, "potato_panics_total %d\n", m.panics)
+
+    buf.WriteString("# HELP potato_websocket_connections Active websocket connections.\n")
+    buf.WriteString("# TYPE potato_websocket_connections gauge\n")
+    fmt.Fprintf(buf, "potato_websocket_connections %d\n", m.wsConns)
+
+    if sessionCount >= 0 {
+        buf.WriteString("# HELP potato_sessions Sessions alive.\n")
+        buf.WriteString("# TYPE potato_sessions gauge\n")
+        fmt.Fprintf(buf, "potato_sessions %d\n", sessionCount)
+    }
+
+    buf.WriteString("# HELP potato_orm_query_duration_seconds Orm query time by action.\n")
+    buf.WriteString("# TYPE potato_orm_query_duration_seconds histogram\n")
+    for _, action := range histogramKeys(m.queries) {
+        writeHistogram(buf, "potato_orm_query_duration_seconds",
+            "action", action, m.queries[action])
+    }
+
+    buf.WriteString("# HELP potato_orm_query_errors_total Failed orm queries by action.\n")
+    buf.WriteString("# TYPE potato_orm_query_errors_total counter\n")
+    for _, action := range counterKeys(m.queryErrors) {
+        fmt.Fprintf(buf, "potato_orm_query_errors_total{action=\"%s\"} %d\n",
+            labelValue(action), m.queryErrors[action])
+    }
+
+    return buf.Bytes()
+}
+
+func writeHistogram(buf *bytes.Buffer, name, label, value string, h *histogram) {
+    value = labelValue(value)
+    for i, b := range MetricsBuckets {
+        fmt.Fprintf(buf, "%s_bucket{%s=\"%s\",le=\"%g\"} %d\n",
+            name, label, value, b, h.counts[i])
+    }
+    fmt.Fprintf(buf, "%s_bucket{%s=\"%s\",le=\"+Inf\"} %d\n", name, label, value, h.count)
+    fmt.Fprintf(buf, "%s_sum{%s=\"%s\"} %g\n", name, label, value, h.sum)
+    fmt.Fprintf(buf, "%s_count{%s=\"%s\"} %d\n", name, label, value, h.count)
+}
+
+func labelValue(v string) string {
+    v = strings.Replace(v, `\`, `\\`, -1)
+    v = strings.Replace(v, `"`, `\"`, -1)
+    return strings.Replace(v, "\n", `\n`, -1)
+}
+
+func histogramKeys(m map[string]*histogram) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func counterKeys(m map[string]uint64) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
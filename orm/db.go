@@ -3,13 +3,19 @@ package orm
 import (
     "database/sql"
     "fmt"
-    "log"
+    "log/slog"
+    "os"
+    "time"
 )
 
 var (
     D   *sql.DB
-    L   *log.Logger
+    L   *slog.Logger
     C   *Config
+
+    //QueryHook if set is called after every query
+    //with the action name, time spent and the error if any
+    QueryHook func(action string, d time.Duration, e error)
 )
 
 type Config struct {
@@ -22,7 +28,7 @@ type Config struct {
     MaxConn int
 }
 
-func Init(c *Config, l *log.Logger) {
+func Init(c *Config, l *slog.Logger) {
     L = l
     C = c
     D = NewDB()
@@ -36,7 +42,8 @@ func NewDB() *sql.DB {
         C.User, C.Pass, C.Host, C.Port, C.DBname)
 
     if db, e = sql.Open(C.Type, dsn); e != nil {
-        log.Fatal(e)
+        L.Error("orm: could not open database", "type", C.Type, "error", e)
+        os.Exit(1)
     }
 
     if C.MaxConn > 0 {
@@ -44,8 +51,16 @@ func NewDB() *sql.DB {
     }
 
     if e = db.Ping(); e != nil {
-        log.Fatal(e)
+        L.Error("orm: could not connect database", "host", C.Host,
+            "port", C.Port, "dbname", C.DBname, "error", e)
+        os.Exit(1)
     }
 
     return db
 }
+
+func observe(action string, t time.Time, e error) {
+    if QueryHook != nil {
+        QueryHook(action, time.Since(t), e)
+    }
+}
@@ -88,15 +88,17 @@ func Save(entity interface{}) bool {
 
         stmt := fmt.Sprintf("INSERT INTO `%s` (%s)VALUES(%s)",
             tbl, strings.Join(cs, ","), strings.Join(ph, ","))
+        t := time.Now()
         result, e := D.Exec(stmt, vals...)
+        observe("insert", t, e)
         if e != nil {
-            L.Println(e)
+            L.Error("orm: insert failed", "table", tbl, "error", e)
             return false
         }
 
         n, e := result.LastInsertId()
         if e != nil {
-            L.Println(e)
+            L.Error("orm: could not get insert id", "table", tbl, "error", e)
             return false
         }
 
@@ -111,8 +113,11 @@ func Save(entity interface{}) bool {
 
     stmt := fmt.Sprintf("UPDATE `%s` SET %s WHERE `id` = %d",
         tbl, strings.Join(sets, ","), pkv)
-    if _, e := D.Exec(stmt, vals...); e != nil {
-        L.Println(e)
+    t := time.Now()
+    _, e := D.Exec(stmt, vals...)
+    observe("update", t, e)
+    if e != nil {
+        L.Error("orm: update failed", "table", tbl, "id", pkv, "error", e)
         return false
     }
 
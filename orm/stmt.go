@@ -15,6 +15,10 @@ const (
     ActionDelete = 4
 )
 
+var (
+    actionNames = []string{"count", "select", "insert", "update", "delete"}
+)
+
 type Stmt struct {
     action int
 
@@ -311,6 +315,13 @@ func (s *Stmt) insert(args ...interface{}) (int64, error) {
 }
 
 func (s *Stmt) Exec(args ...interface{}) (int64, error) {
+    t := time.Now()
+    n, e := s.exec(args...)
+    observe(actionNames[s.action], t, e)
+    return n, e
+}
+
+func (s *Stmt) exec(args ...interface{}) (int64, error) {
     for i, v := range args {
         if t, ok := v.(time.Time); ok {
             args[i] = t.UnixNano()
@@ -348,7 +359,9 @@ func (s *Stmt) Exec(args ...interface{}) (int64, error) {
 }
 
 func (s *Stmt) Query(args ...interface{}) (*Rows, error) {
+    t := time.Now()
     rows, e := D.Query(s.selectStmt(), args...)
+    observe("select", t, e)
     if e != nil {
         return nil, e
     }
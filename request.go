@@ -1,75 +1,85 @@
 package potato
 
 import (
-    ws "code.google.com/p/go.net/websocket"
+    "crypto/rand"
+    "encoding/hex"
+    ws "github.com/roydong/potato/websocket"
     "net/http"
-    "strconv"
+    "time"
+)
+
+const (
+    RequestIdHeader = "X-Request-ID"
 )
 
 type Request struct {
     *http.Request
-    WSConn     *ws.Conn
-    params     map[string]string
-    Session    *Session
-    Cookies    []*http.Cookie
-    Bag        *Tree
+    Input
+    Id        string
+    Route     *Route
+    StartedAt time.Time
+    WSConn    *ws.Conn
+    params    map[string]string
+    Session   *Session
+    Cookies   []*http.Cookie
+    Bag       *Tree
+    sse       *SSEStream
+    flashes   []*Flash
+
+    //number of flashes in the session added by previous requests
+    oldFlashes int
+
+    user       User
+    userLoaded bool
+
+    //user authenticated by a bearer token, which browsers never send by themselves
+    bearerAuth bool
 }
 
 func NewRequest(r *http.Request, p map[string]string) *Request {
     rq := &Request{
-        Request: r,
-        params:  p,
-        Cookies: r.Cookies(),
-        Bag: NewTree(nil),
+        Request:   r,
+        Id:        requestId(r),
+        StartedAt: time.Now(),
+        params:    p,
+        Cookies:   r.Cookies(),
+        Bag:       NewTree(nil),
     }
+    rq.Input = Input{rq.lookup}
 
     return rq
 }
 
-func (r *Request) IsAjax() bool {
-    return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
-}
-
-func (r *Request) Int(k string) (int, bool) {
-    if v, has := r.String(k); has {
-        if i, e := strconv.ParseInt(v, 10, 0); e == nil {
-            return int(i), true
+/**
+ * requestId uses the X-Request-ID from upstream if it is sane
+ * otherwise generates a random one
+ */
+func requestId(r *http.Request) string {
+    if id := r.Header.Get(RequestIdHeader); len(id) > 0 && len(id) <= 128 {
+        valid := true
+        for _, c := range id {
+            if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' ||
+                c >= 'A' && c <= 'Z' || c == '-' || c == '_' || c == '.') {
+                valid = false
+                break
+            }
         }
-    }
-
-    return 0, false
-}
 
-func (r *Request) Int64(k string) (int64, bool) {
-    if v, has := r.String(k); has {
-        if i, e := strconv.ParseInt(v, 10, 64); e == nil {
-            return i, true
+        if valid {
+            return id
         }
     }
 
-    return 0, false
-}
-
-func (r *Request) Float(k string) (float64, bool) {
-    if v, has := r.String(k); has {
-        if f, e := strconv.ParseFloat(v, 64); e == nil {
-            return f, true
-        }
+    rnd := make([]byte, 16)
+    if _, e := rand.Read(rnd); e != nil {
+        panic("could not get random chars while creating request id")
     }
 
-    return 0, false
+    return hex.EncodeToString(rnd)
 }
 
-func (r *Request) String(k string) (string, bool) {
-    if v, has := r.params[k]; has {
-        return v, true
-    }
-
-    if v := r.FormValue(k); len(v) > 0 {
-        return v, true
-    }
-
-    return "", false
+func (r *Request) IsAjax() bool {
+    return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
 }
 
 /**
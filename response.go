@@ -6,7 +6,54 @@ import (
 
 type Response struct {
     http.ResponseWriter
-    Sent bool
+    Sent   bool
+    Status int
+    Size   int64
+    before []func()
+}
+
+/**
+ * BeforeHeader registers f to run right before the header is written
+ * the last chance to set headers like cookies
+ */
+func (r *Response) BeforeHeader(f func()) {
+    r.before = append(r.before, f)
+}
+
+func (r *Response) runBeforeHeader() {
+    before := r.before
+    r.before = nil
+    for _, f := range before {
+        f()
+    }
+}
+
+func (r *Response) WriteHeader(code int) {
+    if r.Status == 0 {
+        r.runBeforeHeader()
+        r.Status = code
+    }
+    r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *Response) Write(b []byte) (int, error) {
+    if r.Status == 0 {
+        r.runBeforeHeader()
+        r.Status = http.StatusOK
+    }
+
+    n, e := r.ResponseWriter.Write(b)
+    r.Size += int64(n)
+    return n, e
+}
+
+/**
+ * Flush sends buffered data to the client if the writer supports it
+ */
+func (r *Response) Flush() {
+    if f, ok := r.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
 }
 
 func (r *Response) SetCookie(c *http.Cookie) {
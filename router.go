@@ -1,11 +1,12 @@
 package potato
 
 import (
-    ws "code.google.com/p/go.net/websocket"
+    ws "github.com/roydong/potato/websocket"
     "net/http"
     "reflect"
     "regexp"
     "strings"
+    "time"
 )
 
 const (
@@ -15,6 +16,15 @@ const (
 var (
     ErrorRouteName string
     NotfoundRouteName string
+
+    //websocket connection settings, zero disables each of them
+    //except max message size which falls back to ws.DefaultMaxMessageSize
+    WSPingInterval   = 30 * time.Second
+    WSReadTimeout    = 60 * time.Second
+    WSWriteTimeout   = 10 * time.Second
+    WSMaxMessageSize = int64(1024 * 1024)
+    WSSendQueue      = 64
+    WSQueuePolicy    = ws.QueueDrop
 )
 
 type Route struct {
@@ -24,6 +34,31 @@ type Route struct {
     Pattern    string   `yaml:"pattern"`
     Keys       []string `yaml:"keys"`
     Regexp     *regexp.Regexp
+
+    //only websocket routes upgrade the connection
+    //origins lists allowed Origin values, empty means same host only
+    WebSocket    bool     `yaml:"websocket"`
+    Origins      []string `yaml:"origins"`
+    Subprotocols []string `yaml:"subprotocols"`
+
+    //dispatch json messages on the websocket to controller methods
+    Dispatch bool `yaml:"dispatch"`
+
+    //no session is loaded or created, for apis and static files
+    //csrf tokens are not checked either as there is no session to keep them
+    NoSession bool `yaml:"no_session"`
+
+    //unsafe requests are not checked for csrf token
+    CSRFExempt bool `yaml:"csrf_exempt"`
+
+    //auth requires a logged in user, roles requires one of them
+    Auth  bool     `yaml:"auth"`
+    Roles []string `yaml:"roles"`
+
+    //max body of multipart requests in bytes, MaxUploadSize if zero
+    MaxUploadSize int64 `yaml:"max_upload_size"`
+
+    prefix *PrefixedRoutes
 }
 
 /**
@@ -32,14 +67,24 @@ type Route struct {
  * then match the patterns of each route
  */
 type PrefixedRoutes struct {
-    Prefix string `yaml:"prefix"`
-    Regexp *regexp.Regexp
-    Routes []*Route `yaml:"routes"`
+    Prefix     string `yaml:"prefix"`
+    Regexp     *regexp.Regexp
+    Routes     []*Route `yaml:"routes"`
+    NoSession  bool     `yaml:"no_session"`
+    CSRFExempt bool     `yaml:"csrf_exempt"`
+    Auth       bool     `yaml:"auth"`
+    Roles      []string `yaml:"roles"`
+
+    //api clients may authenticate with http basic auth
+    //checked against the htpasswd file, or bearer tokens
+    BasicAuth string `yaml:"basic_auth"`
+    Realm     string `yaml:"realm"`
+    Bearer    bool   `yaml:"bearer"`
+    htpasswd  *Htpasswd
 }
 
 type Router struct {
     Event
-    ws            ws.Server
     routes        []*PrefixedRoutes
     errorRoute    *Route
     notfoundRoute *Route
@@ -49,7 +94,6 @@ type Router struct {
 func NewRouter() *Router {
     return &Router{
         Event:         Event{make(map[string][]EventHandler)},
-        ws:            ws.Server{},
         controllers:   make(map[string]reflect.Type),
         errorRoute :   &Route{},
         notfoundRoute: &Route{},
@@ -72,15 +116,46 @@ func (rt *Router) SetControllers(cs map[string]interface{}) {
 
 func (rt *Router) LoadRouteConfig(filename string) {
     if e := LoadYaml(&rt.routes, filename); e != nil {
-        L.Fatal(e)
+        fatal("could not load route config", "file", filename, "error", e)
     }
 
+    rt.initRoutes()
+}
+
+/**
+ * initRoutes compiles the patterns and passes prefix settings to routes
+ */
+func (rt *Router) initRoutes() {
     for _, pr := range rt.routes {
 
         //prepare regexps for prefixed routes
         pr.Regexp = regexp.MustCompile("^" + pr.Prefix + "(.*)$")
+        if len(pr.BasicAuth) > 0 {
+            h, e := LoadHtpasswd(pr.BasicAuth)
+            if e != nil {
+                fatal("could not load htpasswd", "file", pr.BasicAuth, "error", e)
+            }
+            pr.htpasswd = h
+        }
+
         for _, r := range pr.Routes {
+            r.prefix = pr
             r.Regexp = regexp.MustCompile("^" + r.Pattern + "$")
+            if pr.NoSession {
+                r.NoSession = true
+            }
+            if pr.CSRFExempt {
+                r.CSRFExempt = true
+            }
+            if pr.Auth {
+                r.Auth = true
+            }
+
+            //roles of the route take the place of the prefix's
+            if len(r.Roles) == 0 {
+                r.Roles = pr.Roles
+            }
+
             if r.Name == ErrorRouteName {
                 rt.errorRoute = r
             }
@@ -92,22 +167,127 @@ func (rt *Router) LoadRouteConfig(filename string) {
 }
 
 func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    //built-in endpoints bypass routing, sessions and access log
+    switch path := r.URL.Path; {
+    case len(MetricsPath) > 0 && path == MetricsPath:
+        M.ServeHTTP(w, r)
+        return
+    case len(HealthPath) > 0 && path == HealthPath:
+        serveHealth(w, r)
+        return
+    case len(ReadyPath) > 0 && path == ReadyPath:
+        serveReady(w, r)
+        return
+    }
+
     route, params := rt.route(r.URL.Path)
     request := NewRequest(r, params)
-    if strings.ToLower(r.Header.Get("Upgrade")) == "websocket" {
-        if conn := rt.ws.Conn(w, r); conn != nil {
-            request.WSConn = conn
-            defer conn.Close()
+    request.Route = route
+    response := &Response{ResponseWriter: w}
+    response.Header().Set(RequestIdHeader, request.Id)
+    defer rt.finish(request, response)
+
+    limitUpload(request, response)
+    InitSession(request, response)
+    if !authorize(request, response) || !csrf(request, response) {
+        return
+    }
+
+    if route.WebSocket {
+        conn := rt.upgrade(route, w, request, response)
+        if conn == nil {
+            return
         }
+
+        request.WSConn = conn
+        H.Add(conn)
+        M.AddWSConn(1)
+        defer M.AddWSConn(-1)
+        defer conn.Close()
+        defer H.Remove(conn)
     }
 
-    response := &Response{ResponseWriter: w}
-    InitSession(request, response)
     rt.TriggerEvent("request_start", request, response)
     rt.dispatch(route, request, response)
     rt.TriggerEvent("request_end", request, response)
 }
 
+/**
+ * upgrade does the websocket handshake for a websocket route
+ * headers already set on the response like cookies go with the 101 response
+ * on failure it responds 400, 403 or 426 and returns nil
+ */
+func (rt *Router) upgrade(route *Route, w http.ResponseWriter, r *Request, p *Response) *ws.Conn {
+    if !ws.IsUpgrade(r.Request) {
+        p.Header().Set("Upgrade", "websocket")
+        p.Header().Set("Sec-WebSocket-Version", "13")
+        http.Error(p, "websocket upgrade required", http.StatusUpgradeRequired)
+        return nil
+    }
+
+    if !ws.CheckOrigin(r.Request, route.Origins) {
+        L.Warn("websocket origin refused", "route", route.Name,
+            "origin", r.Header.Get("Origin"))
+        http.Error(p, "origin not allowed", http.StatusForbidden)
+        return nil
+    }
+
+    p.runBeforeHeader()
+    header := make(http.Header)
+    for k, v := range p.Header() {
+        header[k] = v
+    }
+
+    if proto := ws.Subprotocol(r.Request, route.Subprotocols); len(proto) > 0 {
+        header.Set("Sec-WebSocket-Protocol", proto)
+    }
+
+    conn, e := ws.Upgrade(w, r.Request, header)
+    if e != nil {
+        L.Warn("websocket handshake failed", "route", route.Name, "error", e)
+        if he, ok := e.(*ws.HandshakeError); ok {
+            if he.Status == http.StatusUpgradeRequired {
+                p.Header().Set("Sec-WebSocket-Version", "13")
+            }
+            http.Error(p, he.Reason, he.Status)
+        }
+
+        return nil
+    }
+
+    conn.MaxMessageSize = WSMaxMessageSize
+    conn.ReadTimeout = WSReadTimeout
+    conn.WriteTimeout = WSWriteTimeout
+    if WSSendQueue > 0 {
+        conn.StartQueue(WSSendQueue, WSQueuePolicy)
+    }
+    if WSPingInterval > 0 {
+        conn.KeepAlive(WSPingInterval)
+    }
+
+    p.Status = http.StatusSwitchingProtocols
+    return conn
+}
+
+func (rt *Router) finish(r *Request, p *Response) {
+    if r.sse != nil {
+        r.sse.Close()
+    }
+
+    //nothing written by the action, header goes out after this
+    if p.Status == 0 {
+        p.runBeforeHeader()
+    }
+
+    if r.Session != nil {
+        SaveSession(r.Session)
+    }
+
+    d := time.Since(r.StartedAt)
+    M.ObserveRequest(r.Route.Name, p.Status, d)
+    writeAccessLog(r, p, d)
+}
+
 func (rt *Router) route(path string) (*Route, map[string]string) {
 
     //case insensitive
@@ -144,9 +324,11 @@ func (rt *Router) dispatch(route *Route, r *Request, p *Response) {
                 return
             }
 
+            M.ObservePanic()
             r.Bag.Set("error", e, true)
             rt.run(rt.errorRoute, r, p)
-            L.Println(e)
+            L.Error("panic recovered", "route", route.Name,
+                "path", r.URL.Path, "error", e)
         }
     }()
 
@@ -157,16 +339,27 @@ func (rt *Router) run(route *Route, r *Request, p *Response) {
     if t, has := rt.controllers[route.Controller]; has {
         c := NewController(t, r, p)
         rt.TriggerEvent("controller_start", c, r, p)
-        if action := c.MethodByName(route.Action); action.IsValid() {
+        action := c.MethodByName(route.Action)
+        dispatch := route.Dispatch && r.WSConn != nil
+
+        //message dispatching routes may have no action
+        if action.IsValid() || dispatch {
 
             //if controller has Init method, run it first
             if init := c.MethodByName("Init"); init.IsValid() {
                 init.Call(nil)
             }
 
-            rt.TriggerEvent("action_start", c, r, p)
-            action.Call(nil)
-            rt.TriggerEvent("action_end", c, r, p)
+            if action.IsValid() {
+                rt.TriggerEvent("action_start", c, r, p)
+                action.Call(nil)
+                rt.TriggerEvent("action_end", c, r, p)
+            }
+
+            if dispatch {
+                rt.serveMessages(route, c, r)
+            }
+
             return
         }
     }
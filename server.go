@@ -1,10 +1,24 @@
 package potato
 
 import (
+    "context"
     "fmt"
+    ws "github.com/roydong/potato/websocket"
     "net"
     "net/http"
     "os"
+    "os/signal"
+    "syscall"
+    "time"
+)
+
+var (
+    //time to keep serving with readiness reported as failed
+    //before closing the listener, lets load balancers notice
+    ShutdownDelay = time.Duration(0)
+
+    //max time to wait for in-flight requests while shutting down
+    ShutdownTimeout = 10 * time.Second
 )
 
 func Serve() {
@@ -15,7 +29,7 @@ func Serve() {
         os.Remove(SockFile)
         lsn, e = net.Listen("unix", SockFile)
         if e != nil {
-            L.Println("fail to open socket file", e)
+            L.Warn("fail to open socket file", "file", SockFile, "error", e)
         } else {
             os.Chmod(SockFile, os.ModePerm)
         }
@@ -26,11 +40,54 @@ func Serve() {
     }
 
     if e != nil {
-        L.Fatal(e)
+        fatal("could not listen", "port", Port, "error", e)
     }
 
     fmt.Println("work work")
+    L.Info("server started", "addr", lsn.Addr().String(), "env", Env)
     s := &http.Server{Handler: R}
-    L.Println(s.Serve(lsn))
-    lsn.Close()
+    s.RegisterOnShutdown(closeLongLived)
+    done := make(chan bool)
+    go shutdownOnSignal(s, done)
+
+    if e := s.Serve(lsn); e != http.ErrServerClosed {
+        L.Error("server stopped", "error", e)
+        lsn.Close()
+        return
+    }
+
+    <-done
+}
+
+/**
+ * shutdownOnSignal shuts the server down gracefully on SIGINT or SIGTERM
+ * readiness fails from the moment the signal arrives
+ */
+func shutdownOnSignal(s *http.Server, done chan bool) {
+    ch := make(chan os.Signal, 1)
+    signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+    sig := <-ch
+
+    setShuttingDown()
+    L.Info("shutting down", "signal", sig.String())
+    time.Sleep(ShutdownDelay)
+
+    ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+    defer cancel()
+    if e := s.Shutdown(ctx); e != nil {
+        L.Error("graceful shutdown failed", "error", e)
+    } else {
+        L.Info("server stopped")
+    }
+
+    close(done)
+}
+
+/**
+ * closeLongLived ends event streams and websocket connections
+ * Shutdown waits for their requests but never cancels them
+ */
+func closeLongLived() {
+    closeStreams()
+    H.CloseAll(ws.CloseGoingAway, "server shutting down")
 }
@@ -0,0 +1,90 @@
+package potato
+
+import (
+    "bufio"
+    "context"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+type streamController struct {
+    Controller
+}
+
+func (c *streamController) Events() {
+    s := c.SSE()
+    s.Send("hello", "", "hi")
+    <-s.Done()
+}
+
+func (c *streamController) Socket() {
+    for {
+        if _, e := c.WSReceive(); e != nil {
+            return
+        }
+    }
+}
+
+func TestShutdownClosesLongLived(t *testing.T) {
+    rt := NewRouter()
+    rt.SetControllers(map[string]interface{}{"stream": &streamController{}})
+    rt.routes = []*PrefixedRoutes{{
+        Prefix:    "",
+        NoSession: true,
+        Routes: []*Route{
+            {Name: "events", Controller: "stream", Action: "Events", Pattern: "/events"},
+            {Name: "socket", Controller: "stream", Action: "Socket", Pattern: "/socket", WebSocket: true},
+        },
+    }}
+    rt.initRoutes()
+
+    ts := httptest.NewUnstartedServer(rt)
+    ts.Config.RegisterOnShutdown(closeLongLived)
+    ts.Start()
+    defer ts.Close()
+
+    //an event stream
+    res, e := http.Get(ts.URL + "/events")
+    if e != nil {
+        t.Fatal(e)
+    }
+    defer res.Body.Close()
+    if line, _ := bufio.NewReader(res.Body).ReadString('\n'); line != "event: hello\n" {
+        t.Fatalf("got %q", line)
+    }
+
+    //a websocket
+    conn, e := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+    if e != nil {
+        t.Fatal(e)
+    }
+    defer conn.Close()
+    conn.Write([]byte("GET /socket HTTP/1.1\r\nHost: " + strings.TrimPrefix(ts.URL, "http://") +
+        "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n" +
+        "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+    if line, _ := bufio.NewReader(conn).ReadString('\n'); !strings.Contains(line, "101") {
+        t.Fatalf("got %q", line)
+    }
+
+    for H.Len() == 0 {
+        time.Sleep(time.Millisecond)
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+    defer cancel()
+    if e := ts.Config.Shutdown(ctx); e != nil {
+        t.Fatal("shutdown waited for long lived requests:", e)
+    }
+
+    //hijacked connections are not waited by Shutdown
+    for i := 0; H.Len() > 0; i++ {
+        if i > 1000 {
+            t.Fatal("websocket not closed")
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
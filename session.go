@@ -1,98 +1,436 @@
 package potato
 
 import (
-    "crypto/md5"
     "crypto/rand"
     "encoding/hex"
-    "fmt"
     "io"
+    "launchpad.net/goyaml"
     "net/http"
     "time"
 )
 
 var (
     SessionDomain     string
-    SessionDuration   = int64(60 * 60 * 24)
     SessionCookieName = "POTATO_SESSION_ID"
+    SessionPath       = "/"
+    SessionSecure     = false
+    SessionHttpOnly   = true
+    SessionSameSite   = http.SameSiteLaxMode
 
-    sessions = make(map[string]*Session)
+    //lifetimes in seconds
+    //SessionDuration is the idle timeout, SessionLifetime the absolute one
+    //SessionMaxAge is the cookie max age, zero for a browser session cookie
+    //remembered sessions use SessionRemember for both the idle timeout
+    //and the cookie max age, and are not bound by SessionLifetime
+    SessionDuration = int64(60 * 60 * 24)
+    SessionLifetime = int64(0)
+    SessionMaxAge   = 0
+    SessionRemember = int64(60 * 60 * 24 * 30)
+
+    //resend persistent cookies on every request, so they expire
+    //after the session is idle rather than after it is created
+    SessionSliding = true
+
+    //where sessions live, set by session_store in config
+    SessionStorage SessionStore = NewMemoryStore()
 )
 
+/**
+ * Session of a request without session cookie is pending,
+ * it reads as empty and is created on the first write
+ * a detached session is never created, used on routes with no_session
+ * a destroyed session is pending again until the next write
+ */
 type Session struct {
     Tree
     Id        string
+    CreatedAt time.Time
     UpdatedAt time.Time
+    remember  bool
+    destroyed bool
+    pending   bool
+    detached  bool
 }
 
-func NewSession(r *Request, p *Response) *Session {
-    s := &Session{
-        Tree:      *NewTree(nil),
-        Id:        sessionId(r),
-        UpdatedAt: time.Now(),
-    }
+/**
+ * sessionData is how a session is serialized by stores
+ * values come back as the basic types yaml decodes to
+ */
+type sessionData struct {
+    Id        string                      `yaml:"id"`
+    CreatedAt int64                       `yaml:"created_at"`
+    UpdatedAt int64                       `yaml:"updated_at"`
+    Remember  bool                        `yaml:"remember"`
+    Data      map[interface{}]interface{} `yaml:"data"`
+}
 
-    //set id in cookie
-    sessions[s.Id] = s
+/**
+ * NewSession returns a pending session, it gets its id
+ * and is saved only after the first write
+ */
+func NewSession() *Session {
+    return &Session{Tree: *NewTree(nil), pending: true}
+}
+
+func setSessionCookie(p *Response, value string, maxAge int) {
     p.SetCookie(&http.Cookie{
         Name:     SessionCookieName,
-        Value:    s.Id,
-        Path:     "/",
+        Value:    value,
+        Path:     SessionPath,
         Domain:   SessionDomain,
-        HttpOnly: true})
+        MaxAge:   maxAge,
+        Secure:   SessionSecure,
+        HttpOnly: SessionHttpOnly,
+        SameSite: SessionSameSite})
+}
 
-    return s
+func expireSessionCookie(p *Response) {
+    setSessionCookie(p, "", -1)
 }
 
 /**
  * InitSession gets current session by session id in cookie
- * if none creates a new session
+ * if none sets a pending session which is created on the first write
+ * an expired session is deleted and taken as none, so its id
+ * is never used again and the next write gets a new one
  */
 func InitSession(r *Request, p *Response) {
+    if r.Route != nil && r.Route.NoSession {
+        r.Session = NewSession()
+        r.Session.detached = true
+        return
+    }
+
     if c := r.Cookie(SessionCookieName); c != nil {
-        r.Session = sessions[c.Value]
+        s, e := SessionStorage.Load(c.Value)
+        if e != nil {
+            L.Error("could not load session", "error", e)
+        }
+
+        if s != nil && s.Expired() {
+            if e := SessionStorage.Delete(s.CurrentId()); e != nil {
+                L.Error("could not delete expired session", "error", e)
+            }
+            s = nil
+        }
+        r.Session = s
     }
 
+    //an empty id makes the cookie written for new sessions
+    id := ""
+    remember := false
     if r.Session == nil {
-        r.Session = NewSession(r, p)
+        r.Session = NewSession()
     } else {
-        t := time.Now()
+        r.Session.touch(time.Now())
+        id = r.Session.CurrentId()
+        remember = r.Session.Remembered()
+    }
+
+    p.BeforeHeader(func() {
+        writeSessionCookie(r, p, id, remember)
+    })
+}
 
-        //check session expiration
-        if r.Session.UpdatedAt.Unix()+SessionDuration < t.Unix() {
-            r.Session.Clear()
+/**
+ * writeSessionCookie writes the cookie for new sessions and updates it
+ * if the session is destroyed, regenerated or remembered during the request
+ * persistent cookies are refreshed with sliding expiration
+ * cookie sessions are always written since the data is in the cookie
+ */
+func writeSessionCookie(r *Request, p *Response, id string, remember bool) {
+    s := r.Session
+    if s.isPending() {
+        if s.isDestroyed() {
+            expireSessionCookie(p)
         }
+        return
+    }
 
-        r.Session.UpdatedAt = t
+    maxAge := s.cookieMaxAge()
+    if cs, ok := SessionStorage.(*CookieStore); ok {
+        //never leave the old cookie on the client, it may be logged in
+        value, e := cs.Encode(s)
+        if e != nil {
+            L.Error("could not write session cookie", "path", r.URL.Path, "error", e)
+            expireSessionCookie(p)
+            return
+        }
+
+        setSessionCookie(p, value, maxAge)
+    } else if cur := s.CurrentId(); cur != id || s.Remembered() != remember || SessionSliding && maxAge > 0 {
+        setSessionCookie(p, cur, maxAge)
     }
 }
 
-func sessionId(r *Request) string {
-    rnd := make([]byte, 24)
-    if _, e := io.ReadFull(rand.Reader, rnd); e != nil {
-        panic("could not get random chars while creating session id")
+/**
+ * Set creates a pending session before writing the value
+ */
+func (s *Session) Set(path string, v interface{}, f bool) bool {
+    s.create()
+    return s.Tree.Set(path, v, f)
+}
+
+/**
+ * create gives a pending session its id, tells if it is created now
+ */
+func (s *Session) create() bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    if !s.pending || s.detached {
+        return false
     }
 
-    sig := fmt.Sprintf("%s%d%s", r.RemoteAddr, time.Now().UnixNano(), rnd)
-    hash := md5.New()
-    if _, e := hash.Write([]byte(sig)); e != nil {
-        panic("could not hash string while creating session id")
+    t := time.Now()
+    s.pending = false
+    s.destroyed = false
+    s.Id = newSessionId()
+    s.CreatedAt = t
+    s.UpdatedAt = t
+    return true
+}
+
+func (s *Session) isPending() bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.pending
+}
+
+func (s *Session) isDestroyed() bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.destroyed
+}
+
+/**
+ * CurrentId reads Id under the lock, as Regenerate may change it
+ * while other requests share the session, stores should use it
+ */
+func (s *Session) CurrentId() string {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.Id
+}
+
+/**
+ * Remember makes the session long-lived, it lasts SessionRemember
+ * seconds since last use and the cookie survives browser restarts
+ */
+func (s *Session) Remember(on bool) {
+    s.create()
+    s.locker.Lock()
+    s.remember = on
+    s.locker.Unlock()
+}
+
+func (s *Session) Remembered() bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.remember
+}
+
+func (s *Session) cookieMaxAge() int {
+    if s.Remembered() {
+        return int(SessionRemember)
+    }
+
+    return SessionMaxAge
+}
+
+/**
+ * Regenerate gives the session a new id and keeps the data
+ * the old id is deleted from the store and can not be used any more
+ * call it after login to prevent session fixation
+ */
+func (s *Session) Regenerate() error {
+
+    //a session created just now has a fresh id already
+    if s.create() || s.isPending() {
+        return nil
     }
 
-    return hex.EncodeToString(hash.Sum(nil))
+    s.locker.Lock()
+    old := s.Id
+    s.Id = newSessionId()
+    s.UpdatedAt = time.Now()
+    s.CreatedAt = s.UpdatedAt
+    s.locker.Unlock()
+
+    if e := SessionStorage.Delete(old); e != nil {
+        return e
+    }
+
+    return SessionStorage.Save(s)
 }
 
 /**
- * sessionExpire checks sessons expiration per minute
- * and delete all expired sessions
+ * Destroy clears the data, deletes the session from the store
+ * and expires the cookie, the session is pending again so a later
+ * write in the same request creates a new one with a new id
+ */
+func (s *Session) Destroy() error {
+    s.locker.Lock()
+    id := s.Id
+    s.data = make(map[interface{}]interface{})
+    s.Id = ""
+    s.remember = false
+    s.pending = true
+    s.destroyed = true
+    s.locker.Unlock()
+
+    if len(id) == 0 {
+        return nil
+    }
+
+    return SessionStorage.Delete(id)
+}
+
+/**
+ * touch renews UpdatedAt, the same session may be used
+ * by concurrent requests so it is guarded by the lock of the tree
+ */
+func (s *Session) touch(t time.Time) {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    s.UpdatedAt = t
+}
+
+/**
+ * Expired tells if the session is over its idle or absolute lifetime
+ */
+func (s *Session) Expired() bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.expired(time.Now())
+}
+
+func (s *Session) expired(t time.Time) bool {
+    return s.expiresAt().Unix() < t.Unix()
+}
+
+/**
+ * ExpiresAt tells when the session expires if not used again
+ * stores keep it with the session so each one is collected on its own lifetime
+ */
+func (s *Session) ExpiresAt() time.Time {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.expiresAt()
+}
+
+func (s *Session) expiresAt() time.Time {
+    if s.remember {
+        return s.UpdatedAt.Add(time.Duration(SessionRemember) * time.Second)
+    }
+
+    t := s.UpdatedAt.Add(time.Duration(SessionDuration) * time.Second)
+    if SessionLifetime > 0 {
+        if end := s.CreatedAt.Add(time.Duration(SessionLifetime) * time.Second); end.Before(t) {
+            return end
+        }
+    }
+
+    return t
+}
+
+/**
+ * idleSince tells if the session is not used since t
+ */
+func (s *Session) idleSince(t time.Time) bool {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return s.UpdatedAt.Before(t)
+}
+
+/**
+ * SaveSession writes the session back to the store
+ * the router calls it when a request is finished
+ */
+func SaveSession(s *Session) {
+    if s.isPending() {
+        return
+    }
+
+    if e := SessionStorage.Save(s); e != nil {
+        L.Error("could not save session", "error", e)
+    }
+}
+
+/**
+ * SessionCount returns the number of sessions alive
+ * or -1 if the store can not count them
+ */
+func SessionCount() int {
+    if c, ok := SessionStorage.(interface{ Len() int }); ok {
+        return c.Len()
+    }
+
+    return -1
+}
+
+func (s *Session) Marshal() ([]byte, error) {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    return goyaml.Marshal(&sessionData{
+        Id:        s.Id,
+        CreatedAt: s.CreatedAt.UnixNano(),
+        UpdatedAt: s.UpdatedAt.UnixNano(),
+        Remember:  s.remember,
+        Data:      s.data,
+    })
+}
+
+func UnmarshalSession(b []byte) (*Session, error) {
+    d := &sessionData{}
+    if e := goyaml.Unmarshal(b, d); e != nil {
+        return nil, e
+    }
+
+    return &Session{
+        Tree:      *NewTree(d.Data),
+        Id:        d.Id,
+        CreatedAt: time.Unix(0, d.CreatedAt),
+        UpdatedAt: time.Unix(0, d.UpdatedAt),
+        remember:  d.Remember,
+    }, nil
+}
+
+/**
+ * newSessionId returns 256 random bits from crypto/rand in hex
+ */
+func newSessionId() string {
+    rnd := make([]byte, 32)
+    if _, e := io.ReadFull(rand.Reader, rnd); e != nil {
+        panic("could not get random chars while creating session id")
+    }
+
+    return hex.EncodeToString(rnd)
+}
+
+/**
+ * sessionExpire asks the store to delete expired sessions per minute
+ * each session goes by its own ExpiresAt, the longest idle timeout
+ * is passed for stores which can not tell that
  */
 func sessionExpire() {
-    for now := range time.Tick(time.Minute) {
-        t := now.Unix()
-        for k, s := range sessions {
-            if s.UpdatedAt.Unix()+SessionDuration < t {
-                s.Clear()
-                delete(sessions, k)
-            }
+    idle := SessionDuration
+    if SessionRemember > idle {
+        idle = SessionRemember
+    }
+
+    for range time.Tick(time.Minute) {
+        if e := SessionStorage.GC(time.Duration(idle) * time.Second); e != nil {
+            L.Error("could not expire sessions", "error", e)
         }
     }
 }
@@ -0,0 +1,327 @@
+package potato
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func newTestSession() *Session {
+    t := time.Now()
+    return &Session{Tree: *NewTree(nil), Id: newSessionId(), CreatedAt: t, UpdatedAt: t}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+    m := NewMemoryStore()
+    wg := &sync.WaitGroup{}
+    for i := 0; i < 16; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            for j := 0; j < 200; j++ {
+                s := newTestSession()
+                s.Set("n", j, true)
+                m.Save(s)
+                if got, _ := m.Load(s.Id); got != s {
+                    t.Errorf("loaded %v, want %v", got, s)
+                }
+                if j%3 == 0 {
+                    m.Delete(s.Id)
+                }
+                if j%50 == 0 {
+                    m.GC(time.Hour)
+                    m.Len()
+                }
+            }
+        }(i)
+    }
+    wg.Wait()
+
+    if n := m.Len(); n != 16*200-16*67 {
+        t.Fatalf("got %d sessions", n)
+    }
+
+    m.GC(-time.Second)
+    if n := m.Len(); n != 0 {
+        t.Fatalf("got %d sessions after gc", n)
+    }
+}
+
+func TestSessionConcurrent(t *testing.T) {
+    s := newTestSession()
+    wg := &sync.WaitGroup{}
+    for i := 0; i < 8; i++ {
+        wg.Add(3)
+        go func(i int) {
+            defer wg.Done()
+            for j := 0; j < 200; j++ {
+                s.Set(fmt.Sprintf("k%d", i), j, true)
+                s.String("k0")
+            }
+        }(i)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 200; j++ {
+                s.touch(time.Now())
+                s.Expired()
+            }
+        }()
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 50; j++ {
+                s.Clear()
+                s.Marshal()
+            }
+        }()
+    }
+    wg.Wait()
+}
+
+func TestRegenerateWhileSaving(t *testing.T) {
+    old := SessionStorage
+    m := NewMemoryStore()
+    SessionStorage = m
+    defer func() { SessionStorage = old }()
+
+    s := newTestSession()
+    s.Set("user", "bob", true)
+    SaveSession(s)
+
+    wg := &sync.WaitGroup{}
+    for i := 0; i < 8; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                if e := s.Regenerate(); e != nil {
+                    t.Error(e)
+                }
+            }
+        }()
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 100; j++ {
+                SaveSession(s)
+                s.CurrentId()
+            }
+        }()
+    }
+    wg.Wait()
+
+    //old ids must not be brought back by saves racing with regenerate
+    if got, _ := m.Load(s.CurrentId()); got != s || m.Len() != 1 {
+        t.Fatalf("session kept under %d ids", m.Len())
+    }
+    if v, _ := s.String("user"); v != "bob" {
+        t.Fatal("data lost by regenerate")
+    }
+
+    if e := s.Destroy(); e != nil {
+        t.Fatal(e)
+    }
+    SaveSession(s)
+    if got, _ := m.Load(s.CurrentId()); got != nil {
+        t.Fatal("destroyed session saved")
+    }
+}
+
+/**
+ * sessionRequest loads the session of id like the router does
+ */
+func sessionRequest(id string) (*Request, *Response, *httptest.ResponseRecorder) {
+    hr := httptest.NewRequest("GET", "/", nil)
+    if len(id) > 0 {
+        hr.AddCookie(&http.Cookie{Name: SessionCookieName, Value: id})
+    }
+
+    w := httptest.NewRecorder()
+    r, p := NewRequest(hr, nil), &Response{ResponseWriter: w}
+    InitSession(r, p)
+    return r, p, w
+}
+
+func TestWriteAfterDestroy(t *testing.T) {
+    old := SessionStorage
+    m := NewMemoryStore()
+    SessionStorage = m
+    defer func() { SessionStorage = old }()
+
+    s := newTestSession()
+    s.Set("user", "bob", true)
+    m.Save(s)
+    id := s.Id
+
+    r, p, w := sessionRequest(id)
+    if e := r.Session.Destroy(); e != nil {
+        t.Fatal(e)
+    }
+    r.Session.Set("flash", "bye", true)
+    SaveSession(r.Session)
+    p.WriteHeader(http.StatusOK)
+
+    cur := r.Session.CurrentId()
+    if got, _ := m.Load(id); got != nil {
+        t.Fatal("destroyed session kept in store")
+    }
+    if cur == id || len(cur) == 0 {
+        t.Fatalf("write after destroy got id %q", cur)
+    }
+    if got, _ := m.Load(cur); got != r.Session || m.Len() != 1 {
+        t.Fatal("write after destroy not saved")
+    }
+    if _, has := r.Session.String("user"); has {
+        t.Fatal("data kept after destroy")
+    }
+
+    cookies := w.Result().Cookies()
+    if len(cookies) != 1 || cookies[0].Value != cur || cookies[0].MaxAge < 0 {
+        t.Fatalf("got cookies %v, want %s", cookies, cur)
+    }
+
+    //without a later write the cookie is expired
+    r, p, w = sessionRequest(cur)
+    r.Session.Destroy()
+    SaveSession(r.Session)
+    p.WriteHeader(http.StatusOK)
+    cookies = w.Result().Cookies()
+    if m.Len() != 0 || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+        t.Fatalf("got cookies %v after destroy", cookies)
+    }
+}
+
+func TestSessionExpiresAt(t *testing.T) {
+    defer func(d, l, r int64) {
+        SessionDuration, SessionLifetime, SessionRemember = d, l, r
+    }(SessionDuration, SessionLifetime, SessionRemember)
+    SessionDuration, SessionLifetime, SessionRemember = 60, 300, 3600
+
+    now := time.Now()
+    tests := []struct {
+        name     string
+        created  time.Duration
+        updated  time.Duration
+        remember bool
+        expires  time.Duration
+    }{
+        {"idle", -10 * time.Second, -10 * time.Second, false, 50 * time.Second},
+        {"lifetime", -290 * time.Second, 0, false, 10 * time.Second},
+        {"remember", -time.Hour, -time.Minute, true, 59 * time.Minute},
+    }
+
+    for _, test := range tests {
+        s := &Session{Tree: *NewTree(nil), CreatedAt: now.Add(test.created),
+            UpdatedAt: now.Add(test.updated), remember: test.remember}
+        if got := s.ExpiresAt().Sub(now); got != test.expires {
+            t.Errorf("%s: expires in %v, want %v", test.name, got, test.expires)
+        }
+    }
+}
+
+func TestFileStoreGC(t *testing.T) {
+    defer func(d, r int64) {
+        SessionDuration, SessionRemember = d, r
+    }(SessionDuration, SessionRemember)
+    SessionDuration, SessionRemember = 60, 3600
+
+    f, e := NewFileStore(t.TempDir())
+    if e != nil {
+        t.Fatal(e)
+    }
+
+    idle := newTestSession()
+    idle.UpdatedAt = time.Now().Add(-2 * time.Minute)
+    remembered := newTestSession()
+    remembered.remember = true
+    remembered.UpdatedAt = idle.UpdatedAt
+    fresh := newTestSession()
+
+    for _, s := range []*Session{idle, remembered, fresh} {
+        if e := f.Save(s); e != nil {
+            t.Fatal(e)
+        }
+    }
+
+    if e := f.GC(time.Duration(SessionRemember) * time.Second); e != nil {
+        t.Fatal(e)
+    }
+
+    for _, test := range []struct {
+        s    *Session
+        kept bool
+    }{{idle, false}, {remembered, true}, {fresh, true}} {
+        s, e := f.Load(test.s.Id)
+        if e != nil {
+            t.Fatal(e)
+        }
+        if (s != nil) != test.kept {
+            t.Errorf("session kept %v, want %v", s != nil, test.kept)
+        }
+    }
+}
+
+func TestNewSessionIsPending(t *testing.T) {
+    old := SessionStorage
+    m := NewMemoryStore()
+    SessionStorage = m
+    defer func() { SessionStorage = old }()
+
+    s := NewSession()
+    SaveSession(s)
+    if m.Len() != 0 || len(s.Id) > 0 {
+        t.Fatal("pending session saved")
+    }
+
+    s.Set("a", 1, true)
+    SaveSession(s)
+    if got, _ := m.Load(s.Id); got != s {
+        t.Fatal("session not saved after the first write")
+    }
+}
+
+func TestExpiredSessionGetsNewId(t *testing.T) {
+    old := SessionStorage
+    m := NewMemoryStore()
+    SessionStorage = m
+    defer func(d, l int64) {
+        SessionStorage = old
+        SessionDuration, SessionLifetime = d, l
+    }(SessionDuration, SessionLifetime)
+    SessionDuration, SessionLifetime = 60, 300
+
+    for _, age := range []time.Duration{0, 2 * time.Minute, 10 * time.Minute} {
+        s := newTestSession()
+        s.CreatedAt = time.Now().Add(-age)
+        s.UpdatedAt = s.CreatedAt
+        if age == 10*time.Minute {
+            //used just now but over the absolute lifetime
+            s.UpdatedAt = time.Now()
+        }
+        s.Set("user", "bob", true)
+        m.Save(s)
+        id := s.Id
+
+        r, _, _ := sessionRequest(id)
+
+        if age == 0 {
+            if r.Session != s {
+                t.Fatal("fresh session not loaded")
+            }
+            continue
+        }
+
+        if got, _ := m.Load(id); got != nil {
+            t.Errorf("expired session %v kept in store", age)
+        }
+
+        r.Session.Set("a", 1, true)
+        if cur := r.Session.CurrentId(); cur == id || len(cur) == 0 {
+            t.Errorf("expired session %v reused id", age)
+        }
+        if v, has := r.Session.String("user"); has {
+            t.Errorf("expired session %v kept data %q", age, v)
+        }
+    }
+}
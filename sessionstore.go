@@ -0,0 +1,344 @@
+package potato
+
+import (
+    "database/sql"
+    "fmt"
+    "github.com/roydong/potato/orm"
+    "hash/fnv"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sync"
+    "time"
+)
+
+const (
+    memoryShards = 32
+)
+
+var (
+    sessionIdRegexp = regexp.MustCompile(`^[0-9a-zA-Z_-]+$`)
+)
+
+/**
+ * SessionStore keeps sessions between requests
+ * Load returns nil without error if the id is not found
+ * GC deletes the expired sessions, each by its own ExpiresAt,
+ * maxIdle is the longest idle timeout of all sessions
+ */
+type SessionStore interface {
+    Load(id string) (*Session, error)
+    Save(s *Session) error
+    Delete(id string) error
+    GC(maxIdle time.Duration) error
+}
+
+/**
+ * NewSessionStore creates the store by name: memory, file or sql
+ * file store saves under dir, sql store uses table with orm.D
+ * which must be opened before
+ * cookie store needs keys and is created by NewCookieStore
+ */
+func NewSessionStore(name, dir, table string) (SessionStore, error) {
+    switch name {
+    case "", "memory":
+        return NewMemoryStore(), nil
+    case "file":
+        return NewFileStore(dir)
+    case "sql":
+        if orm.D == nil {
+            return nil, fmt.Errorf("session store sql needs the sql config")
+        }
+        return NewSqlStore(table), nil
+    }
+
+    return nil, fmt.Errorf("unknown session store %s", name)
+}
+
+/**
+ * MemoryStore keeps sessions in the process, they are lost on restart
+ * sessions are spread over shards by id, each with its own lock
+ * so concurrent requests rarely wait for each other
+ */
+type MemoryStore struct {
+    shards []*memoryShard
+}
+
+type memoryShard struct {
+    locker   sync.RWMutex
+    sessions map[string]*Session
+}
+
+func NewMemoryStore() *MemoryStore {
+    m := &MemoryStore{make([]*memoryShard, memoryShards)}
+    for i := range m.shards {
+        m.shards[i] = &memoryShard{sessions: make(map[string]*Session)}
+    }
+
+    return m
+}
+
+func (m *MemoryStore) shard(id string) *memoryShard {
+    h := fnv.New32a()
+    h.Write([]byte(id))
+    return m.shards[h.Sum32()%memoryShards]
+}
+
+func (m *MemoryStore) Load(id string) (*Session, error) {
+    sh := m.shard(id)
+    sh.locker.RLock()
+    defer sh.locker.RUnlock()
+
+    return sh.sessions[id], nil
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+    id := s.CurrentId()
+    sh := m.shard(id)
+    sh.locker.Lock()
+    defer sh.locker.Unlock()
+
+    //regenerated meanwhile, the old id must not come back
+    //after Regenerate has deleted it
+    if s.CurrentId() != id {
+        return nil
+    }
+
+    sh.sessions[id] = s
+    return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+    sh := m.shard(id)
+    sh.locker.Lock()
+    defer sh.locker.Unlock()
+
+    delete(sh.sessions, id)
+    return nil
+}
+
+/**
+ * GC locks one shard at a time, besides maxIdle
+ * each session is checked against its own lifetime
+ */
+func (m *MemoryStore) GC(maxIdle time.Duration) error {
+    n := 0
+    t := time.Now().Add(-maxIdle)
+    for _, sh := range m.shards {
+        sh.locker.Lock()
+        for k, s := range sh.sessions {
+            if s.idleSince(t) || s.Expired() {
+                s.Clear()
+                delete(sh.sessions, k)
+                n++
+            }
+        }
+        sh.locker.Unlock()
+    }
+
+    if n > 0 {
+        L.Debug("sessions expired", "count", n, "alive", m.Len())
+    }
+
+    return nil
+}
+
+func (m *MemoryStore) Len() int {
+    n := 0
+    for _, sh := range m.shards {
+        sh.locker.RLock()
+        n += len(sh.sessions)
+        sh.locker.RUnlock()
+    }
+
+    return n
+}
+
+/**
+ * FileStore saves each session in a file named by its id under Dir
+ * so sessions survive restarts and can be shared through a mounted dir
+ */
+type FileStore struct {
+    Dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+    if e := os.MkdirAll(dir, 0700); e != nil {
+        return nil, e
+    }
+
+    return &FileStore{dir}, nil
+}
+
+func (f *FileStore) filename(id string) (string, error) {
+    if !sessionIdRegexp.MatchString(id) {
+        return "", fmt.Errorf("invalid session id %q", id)
+    }
+
+    return filepath.Join(f.Dir, id), nil
+}
+
+func (f *FileStore) Load(id string) (*Session, error) {
+    name, e := f.filename(id)
+    if e != nil {
+        return nil, nil
+    }
+
+    b, e := os.ReadFile(name)
+    if os.IsNotExist(e) {
+        return nil, nil
+    }
+
+    if e != nil {
+        return nil, e
+    }
+
+    return UnmarshalSession(b)
+}
+
+/**
+ * Save writes to a temp file then renames it
+ * so readers never see a half written session
+ */
+func (f *FileStore) Save(s *Session) error {
+    id := s.CurrentId()
+    name, e := f.filename(id)
+    if e != nil {
+        return e
+    }
+
+    b, e := s.Marshal()
+    if e != nil {
+        return e
+    }
+
+    expires := s.ExpiresAt()
+    tmp, e := os.CreateTemp(f.Dir, ".tmp-"+id)
+    if e != nil {
+        return e
+    }
+
+    _, e = tmp.Write(b)
+    if e2 := tmp.Close(); e == nil {
+        e = e2
+    }
+
+    //the modification time of the file is when the session expires
+    if e == nil {
+        e = os.Chtimes(tmp.Name(), time.Now(), expires)
+    }
+
+    if e == nil {
+        e = os.Rename(tmp.Name(), name)
+    }
+
+    if e != nil {
+        os.Remove(tmp.Name())
+    }
+
+    return e
+}
+
+func (f *FileStore) Delete(id string) error {
+    name, e := f.filename(id)
+    if e != nil {
+        return e
+    }
+
+    if e := os.Remove(name); e != nil && !os.IsNotExist(e) {
+        return e
+    }
+
+    return nil
+}
+
+/**
+ * GC uses the modification time of files
+ * which is set to the expiration time on every save
+ */
+func (f *FileStore) GC(maxIdle time.Duration) error {
+    entries, e := os.ReadDir(f.Dir)
+    if e != nil {
+        return e
+    }
+
+    t := time.Now()
+    for _, entry := range entries {
+        info, e := entry.Info()
+        if e != nil || info.IsDir() {
+            continue
+        }
+
+        if info.ModTime().Before(t) {
+            os.Remove(filepath.Join(f.Dir, entry.Name()))
+        }
+    }
+
+    return nil
+}
+
+/**
+ * SqlStore saves sessions in a table through orm.D
+ *
+ *     CREATE TABLE `session` (
+ *         `id` VARCHAR(64) NOT NULL PRIMARY KEY,
+ *         `data` BLOB NOT NULL,
+ *         `expires_at` BIGINT NOT NULL,
+ *         KEY `expires_at` (`expires_at`)
+ *     )
+ */
+type SqlStore struct {
+    Table string
+}
+
+func NewSqlStore(table string) *SqlStore {
+    if len(table) == 0 {
+        table = "session"
+    }
+
+    return &SqlStore{table}
+}
+
+func (q *SqlStore) Load(id string) (*Session, error) {
+    var data []byte
+    stmt := fmt.Sprintf("SELECT `data` FROM `%s` WHERE `id` = ?", q.Table)
+    e := orm.D.QueryRow(stmt, id).Scan(&data)
+    if e == sql.ErrNoRows {
+        return nil, nil
+    }
+
+    if e != nil {
+        return nil, e
+    }
+
+    return UnmarshalSession(data)
+}
+
+func (q *SqlStore) Save(s *Session) error {
+    b, e := s.Marshal()
+    if e != nil {
+        return e
+    }
+
+    s.locker.Lock()
+    id, expires := s.Id, s.expiresAt()
+    s.locker.Unlock()
+
+    stmt := fmt.Sprintf("INSERT INTO `%s` (`id`,`data`,`expires_at`)VALUES(?,?,?)"+
+        " ON DUPLICATE KEY UPDATE `data` = VALUES(`data`), `expires_at` = VALUES(`expires_at`)",
+        q.Table)
+    _, e = orm.D.Exec(stmt, id, b, expires.UnixNano())
+    return e
+}
+
+func (q *SqlStore) Delete(id string) error {
+    stmt := fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", q.Table)
+    _, e := orm.D.Exec(stmt, id)
+    return e
+}
+
+func (q *SqlStore) GC(maxIdle time.Duration) error {
+    stmt := fmt.Sprintf("DELETE FROM `%s` WHERE `expires_at` < ?", q.Table)
+    _, e := orm.D.Exec(stmt, time.Now().UnixNano())
+    return e
+}
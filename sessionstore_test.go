@@ -0,0 +1,25 @@
+package potato
+
+import (
+    "testing"
+)
+
+func TestNewSessionStore(t *testing.T) {
+    tests := []struct {
+        name string
+        ok   bool
+    }{
+        {"", true},
+        {"memory", true},
+        {"file", true},
+        {"sql", false},
+        {"redis", false},
+    }
+
+    for _, test := range tests {
+        s, e := NewSessionStore(test.name, t.TempDir(), "")
+        if (e == nil) != test.ok || (s != nil) != test.ok {
+            t.Errorf("%q got %v %v", test.name, s, e)
+        }
+    }
+}
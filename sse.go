@@ -0,0 +1,204 @@
+package potato
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    //interval of the heartbeat comments, zero disables it
+    SSEHeartbeat = 15 * time.Second
+
+    ErrStreamClosed = errors.New("potato: event stream closed")
+
+    //open streams, closed when the server shuts down
+    streams       = make(map[*SSEStream]bool)
+    streamsLocker = &sync.Mutex{}
+)
+
+/**
+ * SSEStream writes server-sent events to the client
+ * it is safe for concurrent use
+ */
+type SSEStream struct {
+    r      *Request
+    p      *Response
+    locker sync.Mutex
+    done   chan bool
+    closed bool
+}
+
+/**
+ * SSE starts an event stream on the current response
+ * the stream is closed when the client goes away or the action returns
+ */
+func (c *Controller) SSE() *SSEStream {
+    if c.Request.sse != nil {
+        return c.Request.sse
+    }
+
+    h := c.Response.Header()
+    h.Set("Content-Type", "text/event-stream; charset=utf-8")
+    h.Set("Cache-Control", "no-cache")
+    h.Set("Connection", "keep-alive")
+    h.Set("X-Accel-Buffering", "no")
+    c.Response.WriteHeader(http.StatusOK)
+    c.Response.Flush()
+    c.Response.Sent = true
+
+    s := &SSEStream{
+        r:    c.Request,
+        p:    c.Response,
+        done: make(chan bool),
+    }
+
+    c.Request.sse = s
+    streamsLocker.Lock()
+    streams[s] = true
+    streamsLocker.Unlock()
+
+    go s.watch()
+    return s
+}
+
+/**
+ * closeStreams closes all open streams, as the server does not cancel
+ * requests on shutdown, the actions waiting on Done would hold it
+ */
+func closeStreams() {
+    streamsLocker.Lock()
+    list := make([]*SSEStream, 0, len(streams))
+    for s := range streams {
+        list = append(list, s)
+    }
+    streamsLocker.Unlock()
+
+    for _, s := range list {
+        s.Close()
+    }
+}
+
+/**
+ * LastEventId is the id of the last event the client received
+ * sent by browsers when they reconnect
+ */
+func (s *SSEStream) LastEventId() string {
+    return s.r.Header.Get("Last-Event-ID")
+}
+
+/**
+ * Done returns a channel closed when the client disconnects
+ * or the stream is closed
+ */
+func (s *SSEStream) Done() <-chan bool {
+    return s.done
+}
+
+/**
+ * Send writes one event, event and id may be empty
+ * multi-line data is split into data fields
+ */
+func (s *SSEStream) Send(event, id, data string) error {
+    buf := new(strings.Builder)
+    if len(event) > 0 {
+        fmt.Fprintf(buf, "event: %s\n", oneLine(event))
+    }
+
+    if len(id) > 0 {
+        fmt.Fprintf(buf, "id: %s\n", oneLine(id))
+    }
+
+    for _, line := range strings.Split(data, "\n") {
+        fmt.Fprintf(buf, "data: %s\n", strings.TrimSuffix(line, "\r"))
+    }
+    buf.WriteString("\n")
+
+    return s.write(buf.String())
+}
+
+func (s *SSEStream) SendJson(event, id string, v interface{}) error {
+    data, e := json.Marshal(v)
+    if e != nil {
+        return e
+    }
+
+    return s.Send(event, id, string(data))
+}
+
+/**
+ * Retry tells the client how long to wait before reconnecting
+ */
+func (s *SSEStream) Retry(d time.Duration) error {
+    return s.write(fmt.Sprintf("retry: %d\n\n", d/time.Millisecond))
+}
+
+/**
+ * Comment writes a comment line which is ignored by clients
+ */
+func (s *SSEStream) Comment(txt string) error {
+    return s.write(fmt.Sprintf(": %s\n\n", oneLine(txt)))
+}
+
+func (s *SSEStream) Close() {
+    s.locker.Lock()
+    if !s.closed {
+        s.closed = true
+        close(s.done)
+    }
+    s.locker.Unlock()
+
+    streamsLocker.Lock()
+    delete(streams, s)
+    streamsLocker.Unlock()
+}
+
+func (s *SSEStream) write(txt string) error {
+    s.locker.Lock()
+    defer s.locker.Unlock()
+
+    if s.closed {
+        return ErrStreamClosed
+    }
+
+    if _, e := s.p.Write([]byte(txt)); e != nil {
+        s.closed = true
+        close(s.done)
+        return e
+    }
+
+    s.p.Flush()
+    return nil
+}
+
+/**
+ * watch sends heartbeats and closes the stream on client disconnect
+ */
+func (s *SSEStream) watch() {
+    var tick <-chan time.Time
+    if SSEHeartbeat > 0 {
+        t := time.NewTicker(SSEHeartbeat)
+        defer t.Stop()
+        tick = t.C
+    }
+
+    for {
+        select {
+        case <-s.done:
+            return
+        case <-s.r.Context().Done():
+            s.Close()
+            return
+        case <-tick:
+            s.Comment("heartbeat")
+        }
+    }
+}
+
+func oneLine(s string) string {
+    return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
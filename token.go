@@ -0,0 +1,97 @@
+package potato
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "strings"
+    "time"
+)
+
+var (
+    //the first key signs new tokens, all keys verify
+    TokenKeys []string
+
+    ErrInvalidToken = errors.New("potato: invalid token")
+    ErrTokenExpired = errors.New("potato: token expired")
+
+    tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+)
+
+type tokenClaims struct {
+    Sub string `json:"sub"`
+    Iat int64  `json:"iat"`
+    Exp int64  `json:"exp,omitempty"`
+}
+
+/**
+ * IssueToken makes a bearer token for the user id
+ * in JWT format signed with HMAC-SHA256, ttl zero never expires
+ */
+func IssueToken(id string, ttl time.Duration) (string, error) {
+    if len(TokenKeys) == 0 {
+        return "", errors.New("potato: no token key configured")
+    }
+
+    now := time.Now()
+    claims := &tokenClaims{Sub: id, Iat: now.Unix()}
+    if ttl > 0 {
+        claims.Exp = now.Add(ttl).Unix()
+    }
+
+    payload, e := json.Marshal(claims)
+    if e != nil {
+        return "", e
+    }
+
+    signed := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+    return signed + "." + tokenSign(TokenKeys[0], signed), nil
+}
+
+/**
+ * VerifyToken checks the signature and expiration
+ * and returns the user id in the token
+ */
+func VerifyToken(token string) (string, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 || parts[0] != tokenHeader {
+        return "", ErrInvalidToken
+    }
+
+    signed := parts[0] + "." + parts[1]
+    valid := false
+    for _, k := range TokenKeys {
+        if hmac.Equal([]byte(parts[2]), []byte(tokenSign(k, signed))) {
+            valid = true
+            break
+        }
+    }
+
+    if !valid {
+        return "", ErrInvalidToken
+    }
+
+    payload, e := base64.RawURLEncoding.DecodeString(parts[1])
+    if e != nil {
+        return "", ErrInvalidToken
+    }
+
+    claims := &tokenClaims{}
+    if e := json.Unmarshal(payload, claims); e != nil || len(claims.Sub) == 0 {
+        return "", ErrInvalidToken
+    }
+
+    if claims.Exp > 0 && claims.Exp < time.Now().Unix() {
+        return "", ErrTokenExpired
+    }
+
+    return claims.Sub, nil
+}
+
+func tokenSign(key, signed string) string {
+    h := hmac.New(sha256.New, []byte(key))
+    h.Write([]byte(signed))
+    return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package potato
+
+import (
+    "encoding/base64"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+/**
+ * signToken signs any header and claims with key like IssueToken does
+ */
+func signToken(key, header, claims string) string {
+    signed := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+        base64.RawURLEncoding.EncodeToString([]byte(claims))
+    return signed + "." + tokenSign(key, signed)
+}
+
+func TestIssueAndVerifyToken(t *testing.T) {
+    TokenKeys = []string{"k1"}
+    defer func() { TokenKeys = nil }()
+
+    for _, ttl := range []time.Duration{0, time.Minute} {
+        token, e := IssueToken("bob", ttl)
+        if e != nil {
+            t.Fatal(e)
+        }
+
+        if id, e := VerifyToken(token); e != nil || id != "bob" {
+            t.Errorf("ttl %v got %q %v", ttl, id, e)
+        }
+    }
+
+    TokenKeys = nil
+    if _, e := IssueToken("bob", 0); e == nil {
+        t.Error("issued without key")
+    }
+}
+
+func TestVerifyTokenRefused(t *testing.T) {
+    TokenKeys = []string{"k1"}
+    defer func() { TokenKeys = nil }()
+
+    header := `{"alg":"HS256","typ":"JWT"}`
+    past := time.Now().Add(-time.Minute).Unix()
+    valid, _ := IssueToken("bob", time.Minute)
+    parts := strings.Split(valid, ".")
+
+    tests := []struct {
+        name  string
+        token string
+        err   error
+    }{
+        {"expired", signToken("k1", header, `{"sub":"bob","exp":`+itoa(past)+`}`), ErrTokenExpired},
+        {"wrong key", signToken("k2", header, `{"sub":"bob"}`), ErrInvalidToken},
+        {"alg none", signToken("k1", `{"alg":"none","typ":"JWT"}`, `{"sub":"bob"}`), ErrInvalidToken},
+        {"alg none unsigned", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".", ErrInvalidToken},
+        {"alg hs512", signToken("k1", `{"alg":"HS512","typ":"JWT"}`, `{"sub":"bob"}`), ErrInvalidToken},
+        {"no subject", signToken("k1", header, `{"iat":1}`), ErrInvalidToken},
+        {"bad claims", signToken("k1", header, `not json`), ErrInvalidToken},
+        {"swapped claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2], ErrInvalidToken},
+        {"no signature", parts[0] + "." + parts[1], ErrInvalidToken},
+        {"empty", "", ErrInvalidToken},
+    }
+
+    for _, test := range tests {
+        if id, e := VerifyToken(test.token); e != test.err {
+            t.Errorf("%s: got %q %v, want %v", test.name, id, e, test.err)
+        }
+    }
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+    defer func() { TokenKeys = nil }()
+
+    TokenKeys = []string{"old"}
+    token, _ := IssueToken("bob", time.Minute)
+
+    TokenKeys = []string{"new", "old"}
+    if id, e := VerifyToken(token); e != nil || id != "bob" {
+        t.Fatalf("old token after rotation got %q %v", id, e)
+    }
+
+    TokenKeys = []string{"new"}
+    if _, e := VerifyToken(token); e != ErrInvalidToken {
+        t.Fatalf("token of dropped key got %v", e)
+    }
+}
+
+func itoa(i int64) string {
+    return strconv.FormatInt(i, 10)
+}
@@ -82,6 +82,9 @@ func (t *Tree) Set(path string, v interface{}, f bool) bool {
  * path is a string with node names divided by dot(.)
  */
 func (t *Tree) Value(path string) interface{} {
+    t.locker.Lock()
+    defer t.locker.Unlock()
+
     nodes := strings.Split(path, ".")
     n := len(nodes) - 1
     if data, ok := t.find(nodes[:n]); ok {
@@ -95,6 +98,9 @@ func (t *Tree) Value(path string) interface{} {
  * Sub returns a *Tree object stores the data found by path
  */
 func (t *Tree) Tree(path string) (*Tree, bool) {
+    t.locker.Lock()
+    defer t.locker.Unlock()
+
     if data, ok := t.find(strings.Split(path, ".")); ok {
         return NewTree(data), true
     }
@@ -102,8 +108,24 @@ func (t *Tree) Tree(path string) (*Tree, bool) {
     return nil, false
 }
 
+/**
+ * Delete removes the value found by path
+ */
+func (t *Tree) Delete(path string) {
+    t.locker.Lock()
+    defer t.locker.Unlock()
+
+    nodes := strings.Split(path, ".")
+    n := len(nodes) - 1
+    if data, ok := t.find(nodes[:n]); ok {
+        delete(data, nodes[n])
+    }
+}
+
 func (t *Tree) Clear() {
+    t.locker.Lock()
     t.data = make(map[interface{}]interface{})
+    t.locker.Unlock()
 }
 
 func (t *Tree) Int(path string) (int, bool) {
@@ -133,6 +155,15 @@ func (t *Tree) Float64(path string) (float64, bool) {
     return 0, false
 }
 
+func (t *Tree) Bool(path string) (bool, bool) {
+    if v := t.Value(path); v != nil {
+        b, ok := v.(bool)
+        return b, ok
+    }
+
+    return false, false
+}
+
 func (t *Tree) String(path string) (string, bool) {
     if v := t.Value(path); v != nil {
         s, ok := v.(string)
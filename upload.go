@@ -0,0 +1,269 @@
+package potato
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "mime/multipart"
+    "net/http"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+var (
+    //max body of multipart requests in bytes, routes may set their own
+    //zero means no limit
+    MaxUploadSize = int64(32 * 1024 * 1024)
+
+    //where uploads are saved, set by upload_dir in config
+    UploadStorage Storage = &DiskStorage{Dir: "upload/"}
+
+    ErrUploadTooLarge = errors.New("upload too large")
+
+    uploadNameRegexp = regexp.MustCompile(`^[0-9a-f]{32}(\.[0-9a-z]{1,10})?$`)
+    uploadExtRegexp  = regexp.MustCompile(`^\.[0-9a-z]{1,10}$`)
+
+    //extensions for sniffed types whose first known extension is odd
+    uploadExts = map[string]string{
+        "text/plain": ".txt",
+        "image/jpeg": ".jpg",
+    }
+)
+
+/**
+ * UploadedFile is a file posted in a multipart form
+ * Name is the base name given by the client, never use it as a path
+ * ContentType is sniffed from the content, not the one claimed by the client
+ */
+type UploadedFile struct {
+    Name        string
+    Size        int64
+    ContentType string
+    header      *multipart.FileHeader
+}
+
+func (f *UploadedFile) Open() (multipart.File, error) {
+    return f.header.Open()
+}
+
+/**
+ * Ext returns the extension for saving the file, decided by the sniffed
+ * content type, the lower case extension of the original name is kept
+ * only if it means the same type, so a script named .jpg stays a text file
+ * html and xml which browsers may run scripts in are saved as .txt
+ * and unknown content as .bin
+ */
+func (f *UploadedFile) Ext() string {
+    sniffed, _, _ := mime.ParseMediaType(f.ContentType)
+    switch sniffed {
+    case "text/html", "text/xml":
+        return ".txt"
+    case "application/octet-stream":
+        return ".bin"
+    }
+
+    ext := strings.ToLower(filepath.Ext(f.Name))
+    if uploadExtRegexp.MatchString(ext) {
+        if t, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext)); t == sniffed {
+            return ext
+        }
+    }
+
+    if ext, has := uploadExts[sniffed]; has {
+        return ext
+    }
+
+    if exts, _ := mime.ExtensionsByType(sniffed); len(exts) > 0 {
+        return exts[0]
+    }
+
+    return ".bin"
+}
+
+func newUploadedFile(h *multipart.FileHeader) (*UploadedFile, error) {
+    file, e := h.Open()
+    if e != nil {
+        return nil, e
+    }
+    defer file.Close()
+
+    //DetectContentType looks at no more than 512 bytes
+    head := make([]byte, 512)
+    n, e := io.ReadFull(file, head)
+    if e != nil && e != io.EOF && e != io.ErrUnexpectedEOF {
+        return nil, e
+    }
+
+    return &UploadedFile{
+        Name:        filepath.Base(strings.ReplaceAll(h.Filename, "\\", "/")),
+        Size:        h.Size,
+        ContentType: http.DetectContentType(head[:n]),
+        header:      h,
+    }, nil
+}
+
+/**
+ * limitUpload caps the body of multipart requests by the max upload size
+ * of the route, it is set before anything reads the body
+ */
+func limitUpload(r *Request, p *Response) {
+    max := MaxUploadSize
+    if r.Route != nil && r.Route.MaxUploadSize > 0 {
+        max = r.Route.MaxUploadSize
+    }
+
+    ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+    if max > 0 && ct == "multipart/form-data" {
+        r.Body = http.MaxBytesReader(p, r.Body, max)
+    }
+}
+
+/**
+ * parseMultipart parses the multipart form once
+ * ErrUploadTooLarge is returned if the body is over the limit
+ */
+func (r *Request) parseMultipart() error {
+    e := r.ParseMultipartForm(MaxMultipartMemory)
+    var me *http.MaxBytesError
+    if errors.As(e, &me) {
+        return ErrUploadTooLarge
+    }
+
+    return e
+}
+
+/**
+ * File returns the first file posted as name
+ * http.ErrMissingFile is returned if there is none
+ */
+func (r *Request) File(name string) (*UploadedFile, error) {
+    files, e := r.Files(name)
+    if e != nil {
+        return nil, e
+    }
+
+    if len(files) == 0 {
+        return nil, http.ErrMissingFile
+    }
+
+    return files[0], nil
+}
+
+/**
+ * Files returns all the files posted as name
+ */
+func (r *Request) Files(name string) ([]*UploadedFile, error) {
+    if e := r.parseMultipart(); e != nil {
+        return nil, e
+    }
+
+    headers := r.MultipartForm.File[name]
+    files := make([]*UploadedFile, 0, len(headers))
+    for _, h := range headers {
+        f, e := newUploadedFile(h)
+        if e != nil {
+            return nil, e
+        }
+        files = append(files, f)
+    }
+
+    return files, nil
+}
+
+/**
+ * Storage keeps uploaded files
+ * Save returns the name to open or delete the file later
+ */
+type Storage interface {
+    Save(f *UploadedFile) (string, error)
+    Open(name string) (io.ReadCloser, error)
+    Delete(name string) error
+}
+
+/**
+ * DiskStorage saves uploads under Dir with random names
+ * and the extension from UploadedFile.Ext, so clients can not
+ * choose where files go or overwrite each other
+ */
+type DiskStorage struct {
+    Dir string
+}
+
+func NewDiskStorage(dir string) *DiskStorage {
+    return &DiskStorage{dir}
+}
+
+func (d *DiskStorage) filename(name string) (string, error) {
+    if !uploadNameRegexp.MatchString(name) {
+        return "", fmt.Errorf("invalid upload name %q", name)
+    }
+
+    return filepath.Join(d.Dir, name), nil
+}
+
+func (d *DiskStorage) Save(f *UploadedFile) (string, error) {
+    if e := os.MkdirAll(d.Dir, 0755); e != nil {
+        return "", e
+    }
+
+    src, e := f.Open()
+    if e != nil {
+        return "", e
+    }
+    defer src.Close()
+
+    name := newUploadName() + f.Ext()
+    filename := filepath.Join(d.Dir, name)
+    dst, e := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+    if e != nil {
+        return "", e
+    }
+
+    _, e = io.Copy(dst, src)
+    if ce := dst.Close(); e == nil {
+        e = ce
+    }
+
+    if e != nil {
+        os.Remove(filename)
+        return "", e
+    }
+
+    return name, nil
+}
+
+func (d *DiskStorage) Open(name string) (io.ReadCloser, error) {
+    filename, e := d.filename(name)
+    if e != nil {
+        return nil, e
+    }
+
+    return os.Open(filename)
+}
+
+func (d *DiskStorage) Delete(name string) error {
+    filename, e := d.filename(name)
+    if e != nil {
+        return e
+    }
+
+    if e := os.Remove(filename); e != nil && !os.IsNotExist(e) {
+        return e
+    }
+
+    return nil
+}
+
+func newUploadName() string {
+    rnd := make([]byte, 16)
+    if _, e := io.ReadFull(rand.Reader, rnd); e != nil {
+        panic("could not get random chars while creating upload name")
+    }
+
+    return hex.EncodeToString(rnd)
+}
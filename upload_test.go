@@ -0,0 +1,118 @@
+package potato
+
+import (
+    "bytes"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+)
+
+var pngHead = []byte("\x89PNG\r\n\x1a\n")
+
+func uploadRequest(name string, content []byte, max int64) *Request {
+    b := &bytes.Buffer{}
+    w := multipart.NewWriter(b)
+    fw, _ := w.CreateFormFile("file", name)
+    fw.Write(content)
+    w.Close()
+
+    hr := httptest.NewRequest("POST", "/", b)
+    hr.Header.Set("Content-Type", w.FormDataContentType())
+    r := NewRequest(hr, map[string]string{})
+    r.Route = &Route{MaxUploadSize: max}
+    limitUpload(r, &Response{ResponseWriter: httptest.NewRecorder()})
+    return r
+}
+
+func TestUploadedFileExt(t *testing.T) {
+    tests := []struct {
+        name    string
+        content []byte
+        ext     string
+    }{
+        {"a.PNG", pngHead, ".png"},
+        {"a.jpg", pngHead, ".png"},
+        {"a", pngHead, ".png"},
+        {"a.txt", []byte("hello"), ".txt"},
+        {"a.html", []byte("<html><script>alert(1)</script></html>"), ".txt"},
+        {"a.png", []byte("<html><script>alert(1)</script></html>"), ".txt"},
+        {"a.svg", []byte(`<?xml version="1.0"?><svg><script>alert(1)</script></svg>`), ".txt"},
+        {"a.php", []byte("<?php echo 1; ?>"), ".txt"},
+        {"a.exe", []byte{0, 1, 2, 3}, ".bin"},
+    }
+
+    for _, test := range tests {
+        f, e := uploadRequest(test.name, test.content, 0).File("file")
+        if e != nil {
+            t.Fatal(e)
+        }
+
+        if ext := f.Ext(); ext != test.ext {
+            t.Errorf("%s as %s got %s, want %s", test.name, f.ContentType, ext, test.ext)
+        }
+    }
+}
+
+func TestUploadFile(t *testing.T) {
+    r := uploadRequest("../../a.png", pngHead, 1000)
+    f, e := r.File("file")
+    if e != nil {
+        t.Fatal(e)
+    }
+
+    if f.Name != "a.png" || f.Size != int64(len(pngHead)) || f.ContentType != "image/png" {
+        t.Fatalf("got %+v", f)
+    }
+
+    if _, e := r.File("none"); e != http.ErrMissingFile {
+        t.Fatalf("missing file got %v", e)
+    }
+
+    if files, e := r.Files("none"); e != nil || len(files) != 0 {
+        t.Fatalf("missing files got %v %v", files, e)
+    }
+
+    big := append(pngHead, make([]byte, 2000)...)
+    if _, e := uploadRequest("a.png", big, 1000).File("file"); e != ErrUploadTooLarge {
+        t.Fatalf("large upload got %v", e)
+    }
+}
+
+func TestDiskStorage(t *testing.T) {
+    f, e := uploadRequest("a.png", pngHead, 0).File("file")
+    if e != nil {
+        t.Fatal(e)
+    }
+
+    s := NewDiskStorage(t.TempDir() + "/upload")
+    name, e := s.Save(f)
+    if e != nil {
+        t.Fatal(e)
+    }
+
+    if !uploadNameRegexp.MatchString(name) || !strings.HasSuffix(name, ".png") {
+        t.Fatalf("bad name %s", name)
+    }
+
+    rc, e := s.Open(name)
+    if e != nil {
+        t.Fatal(e)
+    }
+    rc.Close()
+
+    for _, bad := range []string{"../a.png", "a/b", "", name + "/.."} {
+        if _, e := s.Open(bad); e == nil {
+            t.Errorf("opened %q", bad)
+        }
+    }
+
+    if e := s.Delete(name); e != nil {
+        t.Fatal(e)
+    }
+    if _, e := os.Stat(s.Dir + "/" + name); !os.IsNotExist(e) {
+        t.Fatal("file not deleted")
+    }
+}
@@ -0,0 +1,348 @@
+package validate
+
+import (
+    "errors"
+    "fmt"
+    "net/mail"
+    "net/url"
+    "reflect"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+/**
+ * Rule checks v against param, the error message is shown to users
+ */
+type Rule func(v reflect.Value, param string) error
+
+var (
+    TagName = "validate"
+
+    rules       = make(map[string]Rule)
+    rulesLocker = &sync.RWMutex{}
+
+    regexps       = make(map[string]*regexp.Regexp)
+    regexpsLocker = &sync.Mutex{}
+
+    timeType = reflect.TypeOf(time.Time{})
+)
+
+/**
+ * FieldError tells why a field could not be bound or validated
+ * Field is the path of the input like address.city or items.0.name
+ */
+type FieldError struct {
+    Field   string `json:"field"`
+    Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+    if len(e.Field) == 0 {
+        return e.Message
+    }
+
+    return e.Field + ": " + e.Message
+}
+
+/**
+ * FieldErrors lists all the failed fields
+ */
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+    msgs := make([]string, 0, len(e))
+    for _, fe := range e {
+        msgs = append(msgs, fe.Error())
+    }
+
+    return strings.Join(msgs, "; ")
+}
+
+/**
+ * Map returns messages keyed by field, for templates and json responses
+ * the first message of a field is kept
+ */
+func (e FieldErrors) Map() map[string]string {
+    m := make(map[string]string, len(e))
+    for _, fe := range e {
+        if _, has := m[fe.Field]; !has {
+            m[fe.Field] = fe.Message
+        }
+    }
+
+    return m
+}
+
+/**
+ * Register adds a rule used in tags by name, like validate:"name=param"
+ * built-in rules can be replaced
+ */
+func Register(name string, rule Rule) {
+    rulesLocker.Lock()
+    rules[name] = rule
+    rulesLocker.Unlock()
+}
+
+func init() {
+    Register("min", ruleMin)
+    Register("max", ruleMax)
+    Register("len", ruleLen)
+    Register("email", ruleEmail)
+    Register("url", ruleUrl)
+    Register("oneof", ruleOneof)
+    Register("regexp", ruleRegexp)
+}
+
+/**
+ * Struct checks the fields of the struct v by their validate tags
+ *
+ *     Name  string `form:"name" validate:"required,min=2,max=20"`
+ *     Email string `form:"email" validate:"email"`
+ *     Code  string `form:"code" validate:"regexp=^[a-z]{2,4}$"`
+ *
+ * rules are separated by comma, regexp takes the rest of the tag
+ * so it must be the last one, missing fields without required are skipped
+ * nil pointers, empty strings, slices and maps and zero times are missing
+ * numbers and bools are never missing, use pointers to tell unset from zero
+ * fields are named by form tag, json tag or the field name
+ * nil is returned if all fields are valid
+ */
+func Struct(v interface{}) error {
+    rv := reflect.Indirect(reflect.ValueOf(v))
+    if rv.Kind() != reflect.Struct {
+        return errors.New("validate: Struct needs a struct")
+    }
+
+    errs := make(FieldErrors, 0)
+    checkStruct(rv, "", &errs)
+    if len(errs) > 0 {
+        return errs
+    }
+
+    return nil
+}
+
+func checkStruct(v reflect.Value, prefix string, errs *FieldErrors) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if len(f.PkgPath) > 0 && !f.Anonymous {
+            continue
+        }
+
+        fv := v.Field(i)
+        if f.Anonymous && f.Type.Kind() == reflect.Struct {
+            checkStruct(fv, prefix, errs)
+            continue
+        }
+
+        name := prefix + fieldName(f)
+        if e := checkField(fv, f.Tag.Get(TagName)); e != nil {
+            *errs = append(*errs, &FieldError{name, e.Error()})
+            continue
+        }
+
+        //check nested structs
+        fv = reflect.Indirect(fv)
+        switch {
+        case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+            checkStruct(fv, name+".", errs)
+        case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct:
+            for j := 0; j < fv.Len(); j++ {
+                checkStruct(fv.Index(j), fmt.Sprintf("%s.%d.", name, j), errs)
+            }
+        }
+    }
+}
+
+func fieldName(f reflect.StructField) string {
+    for _, tag := range []string{"form", "json"} {
+        if name := strings.Split(f.Tag.Get(tag), ",")[0]; len(name) > 0 && name != "-" {
+            return name
+        }
+    }
+
+    return f.Name
+}
+
+func checkField(v reflect.Value, tag string) error {
+    if len(tag) == 0 {
+        return nil
+    }
+
+    for len(tag) > 0 {
+        var item string
+        if strings.HasPrefix(tag, "regexp=") {
+            item, tag = tag, ""
+        } else if i := strings.Index(tag, ","); i >= 0 {
+            item, tag = tag[:i], tag[i+1:]
+        } else {
+            item, tag = tag, ""
+        }
+
+        name, param := item, ""
+        if i := strings.Index(item, "="); i >= 0 {
+            name, param = item[:i], item[i+1:]
+        }
+
+        if name == "required" {
+            if isMissing(v) {
+                return errors.New("is required")
+            }
+            continue
+        }
+
+        //optional fields are only checked when filled
+        if isMissing(v) {
+            return nil
+        }
+
+        rulesLocker.RLock()
+        rule, has := rules[name]
+        rulesLocker.RUnlock()
+        if !has {
+            return fmt.Errorf("unknown rule %s", name)
+        }
+
+        if e := rule(reflect.Indirect(v), param); e != nil {
+            return e
+        }
+    }
+
+    return nil
+}
+
+func isMissing(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        return v.IsNil()
+    case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+        return v.Len() == 0
+    case reflect.Struct:
+        return v.IsZero()
+    }
+
+    return false
+}
+
+/**
+ * size is the length of strings in characters, of slices and maps
+ * or the value of numbers
+ */
+func size(v reflect.Value) (float64, bool) {
+    switch v.Kind() {
+    case reflect.String:
+        return float64(utf8.RuneCountInString(v.String())), true
+    case reflect.Slice, reflect.Map, reflect.Array:
+        return float64(v.Len()), true
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return float64(v.Int()), true
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return float64(v.Uint()), true
+    case reflect.Float32, reflect.Float64:
+        return v.Float(), true
+    }
+
+    return 0, false
+}
+
+func isNumber(v reflect.Value) bool {
+    k := v.Kind()
+    return k >= reflect.Int && k <= reflect.Float64
+}
+
+func compare(v reflect.Value, param string, ok func(n, p float64) bool, num, length string) error {
+    p, e := strconv.ParseFloat(param, 64)
+    if e != nil {
+        return fmt.Errorf("invalid rule param %s", param)
+    }
+
+    n, has := size(v)
+    if !has {
+        return fmt.Errorf("can not check %s", v.Type())
+    }
+
+    if ok(n, p) {
+        return nil
+    }
+
+    if isNumber(v) {
+        return fmt.Errorf(num, param)
+    }
+
+    unit := "items"
+    if v.Kind() == reflect.String {
+        unit = "characters"
+    }
+
+    return fmt.Errorf(length, param, unit)
+}
+
+func ruleMin(v reflect.Value, param string) error {
+    return compare(v, param, func(n, p float64) bool { return n >= p },
+        "must be at least %s", "must have at least %s %s")
+}
+
+func ruleMax(v reflect.Value, param string) error {
+    return compare(v, param, func(n, p float64) bool { return n <= p },
+        "must be at most %s", "must have at most %s %s")
+}
+
+func ruleLen(v reflect.Value, param string) error {
+    return compare(v, param, func(n, p float64) bool { return n == p },
+        "must be %s", "must have exactly %s %s")
+}
+
+func ruleEmail(v reflect.Value, param string) error {
+    s := fmt.Sprint(v.Interface())
+    if a, e := mail.ParseAddress(s); e != nil || a.Address != s {
+        return errors.New("must be an email address")
+    }
+
+    return nil
+}
+
+func ruleUrl(v reflect.Value, param string) error {
+    u, e := url.ParseRequestURI(fmt.Sprint(v.Interface()))
+    if e != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+        return errors.New("must be a url")
+    }
+
+    return nil
+}
+
+func ruleOneof(v reflect.Value, param string) error {
+    s := fmt.Sprint(v.Interface())
+    options := strings.Fields(param)
+    for _, o := range options {
+        if s == o {
+            return nil
+        }
+    }
+
+    return fmt.Errorf("must be one of %s", strings.Join(options, ", "))
+}
+
+func ruleRegexp(v reflect.Value, param string) error {
+    regexpsLocker.Lock()
+    r, has := regexps[param]
+    if !has {
+        var e error
+        if r, e = regexp.Compile(param); e != nil {
+            regexpsLocker.Unlock()
+            return fmt.Errorf("invalid rule regexp %s", param)
+        }
+        regexps[param] = r
+    }
+    regexpsLocker.Unlock()
+
+    if !r.MatchString(fmt.Sprint(v.Interface())) {
+        return errors.New("is in wrong format")
+    }
+
+    return nil
+}
@@ -0,0 +1,132 @@
+package validate
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestRules(t *testing.T) {
+    one := 1
+    zero := 0
+    tests := []struct {
+        name  string
+        value interface{}
+        tag   string
+        valid bool
+    }{
+        {"required string", "", "required", false},
+        {"required filled", "a", "required", true},
+        {"required nil pointer", (*int)(nil), "required", false},
+        {"required zero pointer", &zero, "required", true},
+        {"required empty slice", []string{}, "required", false},
+        {"required zero time", time.Time{}, "required", false},
+        {"required zero int", 0, "required", true},
+
+        {"min string", "ab", "min=3", false},
+        {"min string runes", "日本語", "min=3", true},
+        {"min int", 2, "min=3", false},
+        {"min zero int", 0, "min=1", false},
+        {"min float", 3.5, "min=3", true},
+        {"min pointer", &one, "min=2", false},
+        {"min slice", []int{1}, "min=2", false},
+        {"min empty optional", "", "min=3", true},
+        {"min nil optional", (*int)(nil), "min=3", true},
+        {"min invalid param", 1, "min=x", false},
+
+        {"max string", "abcd", "max=3", false},
+        {"max int", 3, "max=3", true},
+        {"max map", map[string]int{"a": 1, "b": 2}, "max=1", false},
+
+        {"len string", "abc", "len=3", true},
+        {"len short", "ab", "len=3", false},
+        {"len int", 4, "len=3", false},
+
+        {"email", "bob@example.com", "email", true},
+        {"email display name", "Bob <bob@example.com>", "email", false},
+        {"email no at", "bob.example.com", "email", false},
+
+        {"url", "https://example.com/a?b=c", "url", true},
+        {"url no scheme", "example.com", "url", false},
+        {"url no host", "https://", "url", false},
+
+        {"oneof", "b", "oneof=a b c", true},
+        {"oneof miss", "d", "oneof=a b c", false},
+        {"oneof int", 2, "oneof=1 2", true},
+        {"oneof zero int", 0, "oneof=1 2", false},
+
+        {"regexp", "abc", "regexp=^[a-z]+$", true},
+        {"regexp miss", "ab1", "regexp=^[a-z]+$", false},
+        {"regexp with comma", "aaa", "min=2,regexp=^a{2,3}$", true},
+        {"regexp invalid", "a", "regexp=(", false},
+
+        {"unknown rule", "a", "nope", false},
+        {"rules in order", "", "required,email", false},
+    }
+
+    for _, test := range tests {
+        e := checkField(reflect.ValueOf(test.value), test.tag)
+        if (e == nil) != test.valid {
+            t.Errorf("%s: %v with %q got %v", test.name, test.value, test.tag, e)
+        }
+    }
+}
+
+type item struct {
+    Name string `form:"name" validate:"required"`
+}
+
+type form struct {
+    Name  string  `form:"name" validate:"required,min=2"`
+    Email string  `json:"email" validate:"email"`
+    Count int     `form:"count" validate:"min=1"`
+    Age   *int    `form:"age" validate:"min=18"`
+    Items []item  `form:"items"`
+    Owner *item   `form:"owner"`
+    Even  int     `validate:"even"`
+    skip  string  `validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+    Register("even", func(v reflect.Value, param string) error {
+        if v.Int()%2 != 0 {
+            return errors.New("must be even")
+        }
+        return nil
+    })
+
+    e := Struct(&form{
+        Name:  "a",
+        Email: "nope",
+        Items: []item{{"x"}, {}},
+        Owner: &item{},
+        Even:  3,
+    })
+
+    want := map[string]string{
+        "name":         "must have at least 2 characters",
+        "email":        "must be an email address",
+        "count":        "must be at least 1",
+        "items.1.name": "is required",
+        "owner.name":   "is required",
+        "Even":         "must be even",
+    }
+
+    fe, ok := e.(FieldErrors)
+    if !ok {
+        t.Fatalf("got %v", e)
+    }
+
+    if got := fe.Map(); !reflect.DeepEqual(got, want) {
+        t.Fatalf("got %v\nwant %v", got, want)
+    }
+
+    if e := Struct(&form{Name: "ab", Count: 1}); e != nil {
+        t.Fatalf("valid form got %v", e)
+    }
+
+    if e := Struct(1); e == nil {
+        t.Fatal("int passed")
+    }
+}
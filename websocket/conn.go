@@ -0,0 +1,569 @@
+package websocket
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "sync"
+    "time"
+    "unicode/utf8"
+)
+
+const (
+    ContinuationFrame = 0
+    TextMessage       = 1
+    BinaryMessage     = 2
+    CloseMessage      = 8
+    PingMessage       = 9
+    PongMessage       = 10
+)
+
+//close codes defined in RFC 6455 section 7.4.1
+const (
+    CloseNormal          = 1000
+    CloseGoingAway       = 1001
+    CloseProtocolError   = 1002
+    CloseUnsupportedData = 1003
+    CloseNoStatus        = 1005
+    CloseAbnormal        = 1006
+    CloseInvalidPayload  = 1007
+    ClosePolicyViolation = 1008
+    CloseMessageTooBig   = 1009
+    CloseMandatoryExt    = 1010
+    CloseInternalError   = 1011
+    CloseTryAgainLater   = 1013
+)
+
+//what Send does when the send queue is full
+const (
+    QueueDrop       = 0
+    QueueDisconnect = 1
+)
+
+const (
+    finBit  = 0x80
+    rsvBits = 0x70
+    maskBit = 0x80
+
+    maxControlPayload = 125
+)
+
+var (
+    //the hard limit of messages when MaxMessageSize is zero
+    //a frame may claim a length up to 2^63, it must never be allocated
+    DefaultMaxMessageSize = int64(16 * 1024 * 1024)
+
+    ErrClosed    = errors.New("websocket: connection closed")
+    ErrQueueFull = errors.New("websocket: send queue full")
+)
+
+/**
+ * CloseError is returned by ReadMessage when the peer closes the connection,
+ * the connection is closed because of a protocol violation or read timeout,
+ * or it is broken, which is CloseAbnormal
+ */
+type CloseError struct {
+    Code int
+    Text string
+}
+
+func (e *CloseError) Error() string {
+    return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+type message struct {
+    typ  int
+    data []byte
+}
+
+type Conn struct {
+    conn        net.Conn
+    br          *bufio.Reader
+    bw          *bufio.Writer
+    writeLocker sync.Mutex
+    closeSent   bool
+    closeOnce   sync.Once
+    done        chan bool
+    queue       chan message
+    closing     chan bool
+    drained     chan bool
+    drainOnce   sync.Once
+    policy      int
+    Subprotocol string
+
+    //PongHandler if set is called with the payload of every pong received
+    PongHandler func(data []byte)
+
+    //limits set before reading or writing, zero timeouts mean no limit
+    //and zero MaxMessageSize means DefaultMaxMessageSize
+    //ReadTimeout is renewed before each frame read
+    //so it should be longer than the keepalive interval
+    MaxMessageSize int64
+    ReadTimeout    time.Duration
+    WriteTimeout   time.Duration
+}
+
+func newConn(conn net.Conn, brw *bufio.ReadWriter) *Conn {
+    return &Conn{
+        conn: conn,
+        br:   brw.Reader,
+        bw:   brw.Writer,
+        done:    make(chan bool),
+        closing: make(chan bool),
+        drained: make(chan bool),
+    }
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+    return c.conn.RemoteAddr()
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+    return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+    return c.conn.SetWriteDeadline(t)
+}
+
+/**
+ * ReadMessage reads the next complete data message
+ * fragmented messages are assembled, pings are answered,
+ * and a close frame is answered then returned as *CloseError
+ */
+func (c *Conn) ReadMessage() (int, []byte, error) {
+    typ := 0
+    var msg []byte
+
+    max := c.MaxMessageSize
+    if max <= 0 {
+        max = DefaultMaxMessageSize
+    }
+
+    for {
+        if c.ReadTimeout > 0 {
+            c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+        }
+
+        fin, op, data, e := c.readFrame(max - int64(len(msg)))
+        if e != nil {
+            return 0, nil, c.readError(e)
+        }
+
+        switch op {
+        case PingMessage:
+            if e := c.writeFrame(PongMessage, data); e != nil && e != ErrClosed {
+                return 0, nil, e
+            }
+            continue
+
+        case PongMessage:
+            if c.PongHandler != nil {
+                c.PongHandler(data)
+            }
+            continue
+
+        case CloseMessage:
+            return 0, nil, c.handleClose(data)
+
+        case ContinuationFrame:
+            if typ == 0 {
+                return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+            }
+
+        case TextMessage, BinaryMessage:
+            if typ != 0 {
+                return 0, nil, c.fail(CloseProtocolError, "expect continuation frame")
+            }
+            typ = op
+
+        default:
+            return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+        }
+
+        msg = append(msg, data...)
+        if fin {
+            if typ == TextMessage && !utf8.Valid(msg) {
+                return 0, nil, c.fail(CloseInvalidPayload, "invalid utf8 text")
+            }
+
+            return typ, msg, nil
+        }
+    }
+}
+
+/**
+ * WriteMessage sends data in one frame, safe for concurrent use
+ */
+func (c *Conn) WriteMessage(typ int, data []byte) error {
+    if typ != TextMessage && typ != BinaryMessage {
+        return errors.New("websocket: invalid message type")
+    }
+
+    return c.writeFrame(typ, data)
+}
+
+/**
+ * StartQueue makes Send put messages into a buffered queue
+ * written by a separate goroutine, so slow peers never block senders
+ * policy decides what to do when the queue is full
+ */
+func (c *Conn) StartQueue(size int, policy int) {
+    c.queue = make(chan message, size)
+    c.policy = policy
+    go c.writeLoop()
+}
+
+/**
+ * Send queues the message if the queue is started
+ * otherwise writes it directly like WriteMessage
+ * ErrQueueFull is returned when the queue is full, with QueueDisconnect
+ * policy the connection is closed as well
+ */
+func (c *Conn) Send(typ int, data []byte) error {
+    if c.queue == nil {
+        return c.WriteMessage(typ, data)
+    }
+
+    if typ != TextMessage && typ != BinaryMessage {
+        return errors.New("websocket: invalid message type")
+    }
+
+    select {
+    case <-c.done:
+        return ErrClosed
+    case <-c.closing:
+        return ErrClosed
+    default:
+    }
+
+    select {
+    case c.queue <- message{typ, data}:
+        return nil
+    default:
+    }
+
+    //the peer is too slow to wait for the queue
+    if c.policy == QueueDisconnect {
+        go c.fail(CloseTryAgainLater, "send queue full")
+    }
+
+    return ErrQueueFull
+}
+
+/**
+ * writeLoop writes queued messages until the connection closes
+ * when Close asks for it the rest of the queue is written then drained is closed
+ */
+func (c *Conn) writeLoop() {
+    for {
+        select {
+        case <-c.done:
+            return
+        case m := <-c.queue:
+            if e := c.writeFrame(m.typ, m.data); e != nil {
+                c.shutdown()
+                return
+            }
+        case <-c.closing:
+            for {
+                select {
+                case m := <-c.queue:
+                    if e := c.writeFrame(m.typ, m.data); e != nil {
+                        c.shutdown()
+                        return
+                    }
+                default:
+                    close(c.drained)
+                    return
+                }
+            }
+        }
+    }
+}
+
+/**
+ * drain waits for the queued messages to be written before closing
+ * no longer than WriteTimeout, Send fails from now on
+ */
+func (c *Conn) drain() {
+    c.drainOnce.Do(func() { close(c.closing) })
+
+    var timeout <-chan time.Time
+    if c.WriteTimeout > 0 {
+        t := time.NewTimer(c.WriteTimeout)
+        defer t.Stop()
+        timeout = t.C
+    }
+
+    select {
+    case <-c.drained:
+    case <-c.done:
+    case <-timeout:
+    }
+}
+
+/**
+ * KeepAlive pings the peer every interval until the connection closes
+ * along with ReadTimeout it drops the dead peers
+ */
+func (c *Conn) KeepAlive(interval time.Duration) {
+    go func() {
+        t := time.NewTicker(interval)
+        defer t.Stop()
+
+        for {
+            select {
+            case <-c.done:
+                return
+            case <-t.C:
+                if e := c.Ping(nil); e != nil {
+                    c.shutdown()
+                    return
+                }
+            }
+        }
+    }()
+}
+
+/**
+ * Done returns a channel closed when the connection is closed
+ */
+func (c *Conn) Done() <-chan bool {
+    return c.done
+}
+
+func (c *Conn) Ping(data []byte) error {
+    if len(data) > maxControlPayload {
+        return errors.New("websocket: control frame too big")
+    }
+
+    return c.writeFrame(PingMessage, data)
+}
+
+/**
+ * CloseWith sends a close frame with code and text then closes the connection
+ * messages still in the send queue are written before the close frame
+ */
+func (c *Conn) CloseWith(code int, text string) error {
+    if c.queue != nil {
+        c.drain()
+    }
+
+    c.writeClose(code, text)
+    return c.shutdown()
+}
+
+/**
+ * Close closes the connection normally
+ */
+func (c *Conn) Close() error {
+    return c.CloseWith(CloseNormal, "")
+}
+
+/**
+ * shutdown closes the underlying connection and stops the goroutines
+ */
+func (c *Conn) shutdown() error {
+    var e error
+    c.closeOnce.Do(func() {
+        close(c.done)
+        e = c.conn.Close()
+    })
+
+    return e
+}
+
+/**
+ * readError turns errors of the underlying connection into *CloseError
+ * a read timeout closes the connection as the peer is gone
+ */
+func (c *Conn) readError(e error) error {
+    if _, ok := e.(*CloseError); ok {
+        return e
+    }
+
+    if ne, ok := e.(net.Error); ok && ne.Timeout() {
+        return c.fail(CloseGoingAway, "read timeout")
+    }
+
+    c.shutdown()
+    return &CloseError{CloseAbnormal, e.Error()}
+}
+
+/**
+ * readFrame reads one frame, a data frame longer than limit
+ * fails the connection
+ */
+func (c *Conn) readFrame(limit int64) (bool, int, []byte, error) {
+    var head [2]byte
+    if _, e := io.ReadFull(c.br, head[:]); e != nil {
+        return false, 0, nil, e
+    }
+
+    fin := head[0]&finBit != 0
+    op := int(head[0] & 0x0f)
+    if head[0]&rsvBits != 0 {
+        return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+    }
+
+    //frames from clients must be masked
+    if head[1]&maskBit == 0 {
+        return false, 0, nil, c.fail(CloseProtocolError, "frame not masked")
+    }
+
+    n := uint64(head[1] & 0x7f)
+    if op >= CloseMessage && (!fin || n > maxControlPayload) {
+        return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+    }
+
+    switch n {
+    case 126:
+        var ext [2]byte
+        if _, e := io.ReadFull(c.br, ext[:]); e != nil {
+            return false, 0, nil, e
+        }
+        n = uint64(binary.BigEndian.Uint16(ext[:]))
+    case 127:
+        var ext [8]byte
+        if _, e := io.ReadFull(c.br, ext[:]); e != nil {
+            return false, 0, nil, e
+        }
+        n = binary.BigEndian.Uint64(ext[:])
+        if n>>63 != 0 {
+            return false, 0, nil, c.fail(CloseProtocolError, "invalid payload length")
+        }
+    }
+
+    if op < CloseMessage && n > uint64(limit) {
+        return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+    }
+
+    var mask [4]byte
+    if _, e := io.ReadFull(c.br, mask[:]); e != nil {
+        return false, 0, nil, e
+    }
+
+    data := make([]byte, n)
+    if _, e := io.ReadFull(c.br, data); e != nil {
+        return false, 0, nil, e
+    }
+
+    for i := range data {
+        data[i] ^= mask[i%4]
+    }
+
+    return fin, op, data, nil
+}
+
+func (c *Conn) writeFrame(op int, data []byte) error {
+    c.writeLocker.Lock()
+    defer c.writeLocker.Unlock()
+
+    if c.closeSent {
+        return ErrClosed
+    }
+
+    if op == CloseMessage {
+        c.closeSent = true
+    }
+
+    if c.WriteTimeout > 0 {
+        c.conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+    }
+
+    head := make([]byte, 0, 10)
+    head = append(head, finBit|byte(op))
+
+    n := len(data)
+    switch {
+    case n <= 125:
+        head = append(head, byte(n))
+    case n <= 0xffff:
+        head = append(head, 126, byte(n>>8), byte(n))
+    default:
+        head = append(head, 127)
+        head = binary.BigEndian.AppendUint64(head, uint64(n))
+    }
+
+    if _, e := c.bw.Write(head); e != nil {
+        return e
+    }
+
+    if _, e := c.bw.Write(data); e != nil {
+        return e
+    }
+
+    return c.bw.Flush()
+}
+
+func (c *Conn) writeClose(code int, text string) error {
+    var data []byte
+    if code != CloseNoStatus {
+        data = make([]byte, 2, 2+len(text))
+        binary.BigEndian.PutUint16(data, uint16(code))
+        data = append(data, text...)
+        if len(data) > maxControlPayload {
+            data = data[:maxControlPayload]
+        }
+    }
+
+    return c.writeFrame(CloseMessage, data)
+}
+
+/**
+ * handleClose answers the close frame from peer
+ * and returns the close reason
+ */
+func (c *Conn) handleClose(data []byte) error {
+    code := CloseNoStatus
+    text := ""
+
+    if len(data) == 1 {
+        return c.fail(CloseProtocolError, "invalid close frame")
+    }
+
+    if len(data) >= 2 {
+        code = int(binary.BigEndian.Uint16(data))
+        text = string(data[2:])
+        if !validCloseCode(code) {
+            return c.fail(CloseProtocolError, "invalid close code")
+        }
+
+        if !utf8.ValidString(text) {
+            return c.fail(CloseInvalidPayload, "invalid utf8 close reason")
+        }
+    }
+
+    reply := code
+    if reply == CloseNoStatus {
+        reply = CloseNormal
+    }
+    c.writeClose(reply, "")
+    c.shutdown()
+
+    return &CloseError{code, text}
+}
+
+/**
+ * fail closes the connection because of an error found on the peer side
+ */
+func (c *Conn) fail(code int, text string) error {
+    c.writeClose(code, text)
+    c.shutdown()
+    return &CloseError{code, text}
+}
+
+func validCloseCode(code int) bool {
+    switch {
+    case code >= 3000 && code <= 4999:
+        return true
+    case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+        return true
+    }
+
+    return false
+}
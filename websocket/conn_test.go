@@ -0,0 +1,444 @@
+package websocket
+
+import (
+    "bufio"
+    "encoding/binary"
+    "io"
+    "net"
+    "testing"
+    "time"
+)
+
+/**
+ * pipe returns a server side conn and the client end of the pipe
+ */
+func pipe() (*Conn, net.Conn) {
+    server, client := net.Pipe()
+    brw := bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))
+    return newConn(server, brw), client
+}
+
+/**
+ * clientFrame makes a masked frame as clients send it
+ */
+func clientFrame(fin bool, op int, data []byte) []byte {
+    b := byte(op)
+    if fin {
+        b |= finBit
+    }
+
+    frame := []byte{b}
+    n := len(data)
+    switch {
+    case n <= 125:
+        frame = append(frame, maskBit|byte(n))
+    case n <= 0xffff:
+        frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+    default:
+        frame = append(frame, maskBit|127)
+        frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+    }
+
+    mask := []byte{0x12, 0x34, 0x56, 0x78}
+    frame = append(frame, mask...)
+    for i, c := range data {
+        frame = append(frame, c^mask[i%4])
+    }
+
+    return frame
+}
+
+/**
+ * readServerFrame reads one unmasked frame sent by the server
+ */
+func readServerFrame(r io.Reader) (bool, int, []byte, error) {
+    var head [2]byte
+    if _, e := io.ReadFull(r, head[:]); e != nil {
+        return false, 0, nil, e
+    }
+
+    n := uint64(head[1] & 0x7f)
+    switch n {
+    case 126:
+        var ext [2]byte
+        io.ReadFull(r, ext[:])
+        n = uint64(binary.BigEndian.Uint16(ext[:]))
+    case 127:
+        var ext [8]byte
+        io.ReadFull(r, ext[:])
+        n = binary.BigEndian.Uint64(ext[:])
+    }
+
+    data := make([]byte, n)
+    _, e := io.ReadFull(r, data)
+    return head[0]&finBit != 0, int(head[0] & 0x0f), data, e
+}
+
+/**
+ * closeCode reads frames from the client end until the close frame
+ */
+func closeCode(t *testing.T, client net.Conn) int {
+    client.SetReadDeadline(time.Now().Add(time.Second))
+    for {
+        _, op, data, e := readServerFrame(client)
+        if e != nil {
+            t.Fatal("no close frame:", e)
+        }
+        if op == CloseMessage {
+            if len(data) < 2 {
+                return CloseNoStatus
+            }
+            return int(binary.BigEndian.Uint16(data))
+        }
+    }
+}
+
+func readResult(c *Conn) chan error {
+    ch := make(chan error, 1)
+    go func() {
+        _, _, e := c.ReadMessage()
+        ch <- e
+    }()
+
+    return ch
+}
+
+func TestHugeFrameLengthWithoutLimit(t *testing.T) {
+    c, client := pipe()
+    result := readResult(c)
+
+    //a 64 bit length of 2^62 must not be allocated
+    head := []byte{finBit | BinaryMessage, maskBit | 127}
+    head = binary.BigEndian.AppendUint64(head, 1<<62)
+    go client.Write(append(head, 1, 2, 3, 4))
+
+    if code := closeCode(t, client); code != CloseMessageTooBig {
+        t.Fatalf("got close code %d", code)
+    }
+
+    ce, ok := (<-result).(*CloseError)
+    if !ok || ce.Code != CloseMessageTooBig {
+        t.Fatalf("got %v", ce)
+    }
+}
+
+func TestMaxMessageSizeOverFragments(t *testing.T) {
+    c, client := pipe()
+    c.MaxMessageSize = 10
+    result := readResult(c)
+
+    go func() {
+        client.Write(clientFrame(false, TextMessage, []byte("123456")))
+        client.Write(clientFrame(true, ContinuationFrame, []byte("789012")))
+    }()
+
+    if code := closeCode(t, client); code != CloseMessageTooBig {
+        t.Fatalf("got close code %d", code)
+    }
+    <-result
+}
+
+func TestReadTimeoutCloses(t *testing.T) {
+    c, client := pipe()
+    c.ReadTimeout = 50 * time.Millisecond
+    result := readResult(c)
+
+    if code := closeCode(t, client); code != CloseGoingAway {
+        t.Fatalf("got close code %d", code)
+    }
+
+    ce, ok := (<-result).(*CloseError)
+    if !ok || ce.Code != CloseGoingAway {
+        t.Fatalf("got %v", ce)
+    }
+
+    select {
+    case <-c.Done():
+    case <-time.After(time.Second):
+        t.Fatal("connection not closed after timeout")
+    }
+}
+
+func TestBrokenConnection(t *testing.T) {
+    c, client := pipe()
+    result := readResult(c)
+    client.Close()
+
+    ce, ok := (<-result).(*CloseError)
+    if !ok || ce.Code != CloseAbnormal {
+        t.Fatalf("got %v", ce)
+    }
+}
+
+/**
+ * send writes frames from the client and returns what ReadMessage gets
+ * along with the frames the server sent back before the message
+ */
+func send(c *Conn, client net.Conn, frames ...[]byte) (int, []byte, error) {
+    go func() {
+        for _, f := range frames {
+            client.Write(f)
+        }
+    }()
+
+    typ, data, e := c.ReadMessage()
+    return typ, data, e
+}
+
+func TestReadMessageLengths(t *testing.T) {
+    for _, n := range []int{0, 1, 125, 126, 0xffff, 0x10000, 100000} {
+        c, client := pipe()
+        data := make([]byte, n)
+        for i := range data {
+            data[i] = byte(i)
+        }
+
+        typ, got, e := send(c, client, clientFrame(true, BinaryMessage, data))
+        if e != nil || typ != BinaryMessage || string(got) != string(data) {
+            t.Errorf("length %d got %d bytes, type %d, %v", n, len(got), typ, e)
+        }
+    }
+}
+
+func TestWriteMessageLengths(t *testing.T) {
+    for _, n := range []int{0, 125, 126, 0xffff, 0x10000} {
+        c, client := pipe()
+        data := make([]byte, n)
+        go c.WriteMessage(TextMessage, data)
+
+        fin, op, got, e := readServerFrame(client)
+        if e != nil || !fin || op != TextMessage || len(got) != n {
+            t.Errorf("length %d got %d bytes, op %d, %v", n, len(got), op, e)
+        }
+    }
+
+    c, _ := pipe()
+    if e := c.WriteMessage(PingMessage, nil); e == nil {
+        t.Error("WriteMessage sent a control frame")
+    }
+}
+
+func TestUnmaskedFrame(t *testing.T) {
+    c, client := pipe()
+    frame := []byte{finBit | TextMessage, 2, 'h', 'i'}
+    go client.Write(frame)
+    result := readResult(c)
+
+    if code := closeCode(t, client); code != CloseProtocolError {
+        t.Fatalf("got close code %d", code)
+    }
+    <-result
+}
+
+func TestFragmentedWithControlFrames(t *testing.T) {
+    c, client := pipe()
+    pongs := make(chan string, 1)
+    c.PongHandler = func(data []byte) { pongs <- string(data) }
+
+    frames := [][]byte{
+        clientFrame(false, TextMessage, []byte("hel")),
+        clientFrame(true, PingMessage, []byte("p1")),
+        clientFrame(false, ContinuationFrame, []byte("lo ")),
+        clientFrame(true, PongMessage, []byte("p2")),
+        clientFrame(true, ContinuationFrame, []byte("wörld")),
+    }
+
+    //the pong for the ping is read while the message is assembled
+    answered := make(chan []byte, 1)
+    go func() {
+        _, op, data, _ := readServerFrame(client)
+        if op == PongMessage {
+            answered <- data
+        }
+    }()
+
+    typ, data, e := send(c, client, frames...)
+    if e != nil || typ != TextMessage || string(data) != "hello wörld" {
+        t.Fatalf("got %d %q %v", typ, data, e)
+    }
+
+    if p := <-answered; string(p) != "p1" {
+        t.Errorf("ping answered with %q", p)
+    }
+    if p := <-pongs; p != "p2" {
+        t.Errorf("pong handler got %q", p)
+    }
+}
+
+func TestInvalidFrames(t *testing.T) {
+    long := make([]byte, 126)
+    tests := []struct {
+        name   string
+        frames [][]byte
+        code   int
+    }{
+        {"continuation first", [][]byte{clientFrame(true, ContinuationFrame, []byte("a"))}, CloseProtocolError},
+        {"new message in fragments", [][]byte{
+            clientFrame(false, TextMessage, []byte("a")),
+            clientFrame(true, TextMessage, []byte("b")),
+        }, CloseProtocolError},
+        {"fragmented control", [][]byte{clientFrame(false, PingMessage, nil)}, CloseProtocolError},
+        {"long control", [][]byte{clientFrame(true, PingMessage, long)}, CloseProtocolError},
+        {"unknown opcode", [][]byte{clientFrame(true, 3, nil)}, CloseProtocolError},
+        {"reserved bits", [][]byte{append([]byte{finBit | 0x40 | TextMessage}, clientFrame(true, TextMessage, nil)[1:]...)}, CloseProtocolError},
+        {"invalid utf8", [][]byte{clientFrame(true, TextMessage, []byte{0xff, 0xfe})}, CloseInvalidPayload},
+        {"invalid utf8 over fragments", [][]byte{
+            clientFrame(false, TextMessage, []byte{0xe4, 0xb8}),
+            clientFrame(true, ContinuationFrame, []byte{0x41}),
+        }, CloseInvalidPayload},
+    }
+
+    for _, test := range tests {
+        c, client := pipe()
+        result := make(chan error, 1)
+        go func() {
+            _, _, e := send(c, client, test.frames...)
+            result <- e
+        }()
+
+        if code := closeCode(t, client); code != test.code {
+            t.Errorf("%s: got close code %d, want %d", test.name, code, test.code)
+        }
+
+        ce, ok := (<-result).(*CloseError)
+        if !ok || ce.Code != test.code {
+            t.Errorf("%s: got %v", test.name, ce)
+        }
+    }
+}
+
+func closePayload(code int, text string) []byte {
+    b := binary.BigEndian.AppendUint16(nil, uint16(code))
+    return append(b, text...)
+}
+
+func TestCloseCodes(t *testing.T) {
+    tests := []struct {
+        name    string
+        payload []byte
+        reply   int
+        err     int
+    }{
+        {"normal", closePayload(CloseNormal, "bye"), CloseNormal, CloseNormal},
+        {"going away", closePayload(CloseGoingAway, ""), CloseGoingAway, CloseGoingAway},
+        {"application", closePayload(4000, ""), 4000, 4000},
+        {"no status", nil, CloseNormal, CloseNoStatus},
+        {"reserved 1005", closePayload(CloseNoStatus, ""), CloseProtocolError, CloseProtocolError},
+        {"reserved 1006", closePayload(CloseAbnormal, ""), CloseProtocolError, CloseProtocolError},
+        {"out of range", closePayload(999, ""), CloseProtocolError, CloseProtocolError},
+        {"one byte", []byte{3}, CloseProtocolError, CloseProtocolError},
+        {"invalid utf8 reason", closePayload(CloseNormal, "\xff"), CloseInvalidPayload, CloseInvalidPayload},
+    }
+
+    for _, test := range tests {
+        c, client := pipe()
+        result := make(chan error, 1)
+        go func() {
+            _, _, e := send(c, client, clientFrame(true, CloseMessage, test.payload))
+            result <- e
+        }()
+
+        if code := closeCode(t, client); code != test.reply {
+            t.Errorf("%s: replied %d, want %d", test.name, code, test.reply)
+        }
+
+        ce, ok := (<-result).(*CloseError)
+        if !ok || ce.Code != test.err {
+            t.Errorf("%s: got %v, want code %d", test.name, ce, test.err)
+        }
+
+        select {
+        case <-c.Done():
+        case <-time.After(time.Second):
+            t.Errorf("%s: connection not closed", test.name)
+        }
+    }
+}
+
+func TestCloseWith(t *testing.T) {
+    c, client := pipe()
+    go c.CloseWith(CloseTryAgainLater, "busy")
+
+    _, op, data, e := readServerFrame(client)
+    if e != nil || op != CloseMessage || binary.BigEndian.Uint16(data) != CloseTryAgainLater || string(data[2:]) != "busy" {
+        t.Fatalf("got op %d %q %v", op, data, e)
+    }
+
+    <-c.Done()
+    if e := c.WriteMessage(TextMessage, []byte("late")); e != ErrClosed {
+        t.Fatalf("write after close got %v", e)
+    }
+}
+
+func TestSendQueue(t *testing.T) {
+    c, client := pipe()
+    c.StartQueue(1, QueueDrop)
+    defer c.shutdown()
+
+    //nothing reads the client end, so the writer blocks on one message
+    //and the queue holds one more, then it is full
+    n := 0
+    for ; n < 10; n++ {
+        if e := c.Send(TextMessage, []byte{byte('0' + n)}); e == ErrQueueFull {
+            break
+        }
+    }
+
+    if n == 0 || n > 2 {
+        t.Fatalf("queued %d messages", n)
+    }
+
+    for i := 0; i < n; i++ {
+        _, _, data, e := readServerFrame(client)
+        if e != nil || data[0] != byte('0'+i) {
+            t.Fatalf("got %q %v, want %d", data, e, i)
+        }
+    }
+}
+
+func TestCloseDrainsQueue(t *testing.T) {
+    c, client := pipe()
+    c.WriteTimeout = time.Second
+    c.StartQueue(64, QueueDrop)
+
+    for _, msg := range []string{"one", "two", "bye"} {
+        if e := c.Send(TextMessage, []byte(msg)); e != nil {
+            t.Fatal(e)
+        }
+    }
+    go c.Close()
+
+    for _, msg := range []string{"one", "two", "bye"} {
+        _, op, data, e := readServerFrame(client)
+        if e != nil || op != TextMessage || string(data) != msg {
+            t.Fatalf("got op %d %q %v, want %q", op, data, e, msg)
+        }
+    }
+
+    if code := closeCode(t, client); code != CloseNormal {
+        t.Fatalf("closed with %d", code)
+    }
+
+    <-c.Done()
+    if e := c.Send(TextMessage, []byte("late")); e != ErrClosed {
+        t.Fatalf("send after close got %v", e)
+    }
+}
+
+func TestCloseDrainTimeout(t *testing.T) {
+    c, client := pipe()
+    c.WriteTimeout = 50 * time.Millisecond
+    c.StartQueue(64, QueueDrop)
+    c.Send(TextMessage, []byte("stuck"))
+
+    //nothing reads the client end, Close gives up after WriteTimeout
+    done := make(chan error, 1)
+    go func() { done <- c.Close() }()
+
+    select {
+    case <-done:
+    case <-time.After(2 * time.Second):
+        t.Fatal("close blocked on the queue")
+    }
+    client.Close()
+}
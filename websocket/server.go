@@ -0,0 +1,168 @@
+package websocket
+
+import (
+    "crypto/sha1"
+    "encoding/base64"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+const (
+    acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+/**
+ * HandshakeError tells why the upgrade request is refused
+ * Status is the http status should be responded to the client
+ */
+type HandshakeError struct {
+    Status int
+    Reason string
+}
+
+func (e *HandshakeError) Error() string {
+    return "websocket: " + e.Reason
+}
+
+/**
+ * IsUpgrade tells if the request asks for a websocket connection
+ */
+func IsUpgrade(r *http.Request) bool {
+    return headerHas(r.Header, "Connection", "upgrade") &&
+        headerHas(r.Header, "Upgrade", "websocket")
+}
+
+/**
+ * Upgrade checks the opening handshake then hijacks the connection
+ * header is added to the 101 response
+ * on *HandshakeError nothing is written, the caller should respond
+ */
+func Upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (*Conn, error) {
+    if r.Method != "GET" {
+        return nil, &HandshakeError{http.StatusMethodNotAllowed, "method must be GET"}
+    }
+
+    if !IsUpgrade(r) {
+        return nil, &HandshakeError{http.StatusBadRequest, "not a websocket upgrade request"}
+    }
+
+    if r.Header.Get("Sec-Websocket-Version") != "13" {
+        return nil, &HandshakeError{http.StatusUpgradeRequired, "unsupported version"}
+    }
+
+    key := r.Header.Get("Sec-Websocket-Key")
+    if k, e := base64.StdEncoding.DecodeString(key); e != nil || len(k) != 16 {
+        return nil, &HandshakeError{http.StatusBadRequest, "invalid Sec-WebSocket-Key"}
+    }
+
+    hj, ok := w.(http.Hijacker)
+    if !ok {
+        return nil, &HandshakeError{http.StatusInternalServerError, "response can not be hijacked"}
+    }
+
+    conn, brw, e := hj.Hijack()
+    if e != nil {
+        return nil, e
+    }
+
+    resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+        "Upgrade: websocket\r\n" +
+        "Connection: Upgrade\r\n" +
+        "Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n"
+    for k, vs := range header {
+        for _, v := range vs {
+            resp += fmt.Sprintf("%s: %s\r\n", k, v)
+        }
+    }
+    resp += "\r\n"
+
+    if _, e := brw.WriteString(resp); e != nil {
+        conn.Close()
+        return nil, e
+    }
+
+    if e := brw.Flush(); e != nil {
+        conn.Close()
+        return nil, e
+    }
+
+    c := newConn(conn, brw)
+    c.Subprotocol = header.Get("Sec-Websocket-Protocol")
+    return c, nil
+}
+
+/**
+ * CheckOrigin tells if the Origin of the request is allowed
+ * requests without Origin are not from browsers and always allowed
+ * with no allowed origins only the same host is accepted
+ * "*" accepts any origin, others match "scheme://host" or just the host
+ */
+func CheckOrigin(r *http.Request, allowed []string) bool {
+    origin := r.Header.Get("Origin")
+    if len(origin) == 0 {
+        return true
+    }
+
+    u, e := url.Parse(origin)
+    if e != nil {
+        return false
+    }
+
+    if len(allowed) == 0 {
+        return strings.EqualFold(u.Host, r.Host)
+    }
+
+    for _, a := range allowed {
+        if a == "*" || strings.EqualFold(a, origin) || strings.EqualFold(a, u.Host) {
+            return true
+        }
+    }
+
+    return false
+}
+
+/**
+ * Subprotocol picks the first protocol requested by the client
+ * that the server supports, empty if none matches
+ */
+func Subprotocol(r *http.Request, supported []string) string {
+    for _, v := range r.Header[http.CanonicalHeaderKey("Sec-WebSocket-Protocol")] {
+        for _, p := range strings.Split(v, ",") {
+            p = strings.TrimSpace(p)
+            for _, s := range supported {
+                if p == s {
+                    return p
+                }
+            }
+        }
+    }
+
+    return ""
+}
+
+/**
+ * AcceptKey computes Sec-WebSocket-Accept for the client key
+ */
+func AcceptKey(key string) string {
+    h := sha1.New()
+    h.Write([]byte(key + acceptGUID))
+    return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+/**
+ * headerHas checks comma separated header values for token
+ * case insensitively
+ */
+func headerHas(h http.Header, name, token string) bool {
+    for _, v := range h[http.CanonicalHeaderKey(name)] {
+        for _, t := range strings.Split(v, ",") {
+            if strings.EqualFold(strings.TrimSpace(t), token) {
+                return true
+            }
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,131 @@
+package websocket
+
+import (
+    "bufio"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestAcceptKey(t *testing.T) {
+    //the example of RFC 6455 section 1.3
+    if k := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+        t.Fatalf("got %s", k)
+    }
+}
+
+func upgradeRequest() *http.Request {
+    r := httptest.NewRequest("GET", "/ws", nil)
+    r.Header.Set("Connection", "keep-alive, Upgrade")
+    r.Header.Set("Upgrade", "websocket")
+    r.Header.Set("Sec-WebSocket-Version", "13")
+    r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+    return r
+}
+
+func TestUpgradeRefused(t *testing.T) {
+    tests := []struct {
+        name   string
+        change func(r *http.Request)
+        status int
+    }{
+        {"post", func(r *http.Request) { r.Method = "POST" }, http.StatusMethodNotAllowed},
+        {"no upgrade", func(r *http.Request) { r.Header.Del("Upgrade") }, http.StatusBadRequest},
+        {"version", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+        {"no key", func(r *http.Request) { r.Header.Del("Sec-WebSocket-Key") }, http.StatusBadRequest},
+        {"short key", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+    }
+
+    for _, test := range tests {
+        r := upgradeRequest()
+        test.change(r)
+        _, e := Upgrade(httptest.NewRecorder(), r, nil)
+        he, ok := e.(*HandshakeError)
+        if !ok || he.Status != test.status {
+            t.Errorf("%s: got %v, want status %d", test.name, e, test.status)
+        }
+    }
+}
+
+func TestUpgrade(t *testing.T) {
+    done := make(chan *Conn, 1)
+    ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        h := http.Header{}
+        h.Set("Sec-WebSocket-Protocol", Subprotocol(r, []string{"chat.v2", "chat.v1"}))
+        c, e := Upgrade(w, r, h)
+        if e != nil {
+            t.Error(e)
+        }
+        done <- c
+    }))
+    defer ts.Close()
+
+    r := upgradeRequest()
+    r.RequestURI = ""
+    r.URL, _ = r.URL.Parse(ts.URL + "/ws")
+    r.Header.Set("Sec-WebSocket-Protocol", "chat.v1, chat.v2")
+
+    res, e := http.DefaultTransport.RoundTrip(r)
+    if e != nil {
+        t.Fatal(e)
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode != http.StatusSwitchingProtocols ||
+        res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" ||
+        res.Header.Get("Sec-WebSocket-Protocol") != "chat.v1" {
+        t.Fatalf("got %d %v", res.StatusCode, res.Header)
+    }
+
+    c := <-done
+    defer c.Close()
+    if c.Subprotocol != "chat.v1" {
+        t.Fatalf("subprotocol %q", c.Subprotocol)
+    }
+
+    //the body of a 101 response is the connection
+    rw, ok := res.Body.(interface {
+        Write([]byte) (int, error)
+    })
+    if !ok {
+        t.Skip("transport gives no writable body")
+    }
+
+    go rw.Write(clientFrame(true, TextMessage, []byte("hi")))
+    typ, data, e := c.ReadMessage()
+    if e != nil || typ != TextMessage || string(data) != "hi" {
+        t.Fatalf("got %d %q %v", typ, data, e)
+    }
+
+    go c.WriteMessage(TextMessage, []byte("yo"))
+    _, _, got, e := readServerFrame(bufio.NewReader(res.Body))
+    if e != nil || string(got) != "yo" {
+        t.Fatalf("got %q %v", got, e)
+    }
+}
+
+func TestCheckOrigin(t *testing.T) {
+    tests := []struct {
+        origin  string
+        allowed []string
+        ok      bool
+    }{
+        {"", nil, true},
+        {"http://example.com", nil, true},
+        {"http://evil.com", nil, false},
+        {"https://a.com", []string{"https://a.com"}, true},
+        {"https://a.com", []string{"a.com"}, true},
+        {"https://b.com", []string{"a.com"}, false},
+        {"https://b.com", []string{"*"}, true},
+    }
+
+    for _, test := range tests {
+        r := httptest.NewRequest("GET", "http://example.com/ws", nil)
+        if len(test.origin) > 0 {
+            r.Header.Set("Origin", test.origin)
+        }
+        if ok := CheckOrigin(r, test.allowed); ok != test.ok {
+            t.Errorf("%q with %v got %v", test.origin, test.allowed, ok)
+        }
+    }
+}